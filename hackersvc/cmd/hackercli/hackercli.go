@@ -2,9 +2,13 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"strings"
 	"text/tabwriter"
 	"time"
 
@@ -13,30 +17,65 @@ import (
 	"github.com/apache/thrift/lib/go/thrift"
 	lightstep "github.com/lightstep/lightstep-tracer-go"
 	stdopentracing "github.com/opentracing/opentracing-go"
-	zipkin "github.com/openzipkin/zipkin-go-opentracing"
+	zipkinot "github.com/openzipkin-contrib/zipkin-go-opentracing"
+	"github.com/openzipkin/zipkin-go"
+	zipkinhttp "github.com/openzipkin/zipkin-go/reporter/http"
+	"github.com/sony/gobreaker"
+	"go.opentelemetry.io/otel/exporters/jaeger"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
 	"sourcegraph.com/sourcegraph/appdash"
 	appdashot "sourcegraph.com/sourcegraph/appdash/opentracing"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
 
 	"github.com/ctfsys/backend/hackersvc/pkg/hackerservice"
 	"github.com/ctfsys/backend/hackersvc/pkg/hackertransport"
+	"github.com/ctfsys/backend/hackersvc/pkg/hackertransport/sd/consul"
+	"github.com/ctfsys/backend/hackersvc/pkg/hackertransport/sd/dnssrv"
+	"github.com/ctfsys/backend/hackersvc/pkg/hackertransport/sd/etcdv3"
 	hackerthrift "github.com/ctfsys/backend/hackersvc/thrift/gen-go/hackersvc"
 )
 
 func main() {
 	fs := flag.NewFlagSet("hackercli", flag.ExitOnError)
 	var (
-		httpAddr       = fs.String("http-addr", "", "HTTP address of hackersvc")
-		grpcAddr       = fs.String("grpc-addr", "", "gRPC address of hackersvc")
-		thriftAddr     = fs.String("thrift-addr", "", "Thrift address of hackersvc")
-		thriftProtocol = fs.String("thrift-protocol", "binary", "binary, compact, json, simplejson")
-		thriftBuffer   = fs.Int("thrift-buffer", 0, "0 for unbuffered")
-		thriftFramed   = fs.Bool("thrift-framed", false, "true to enable framing")
-		zipkinURL      = fs.String("zipkin-url", "", "Enable Zipkin tracing via a collector URL e.g. http://localhost:9411/api/v1/spans")
-		lightstepToken = flag.String("lightstep-token", "", "Enable LightStep tracing via a LightStep access token")
-		appdashAddr    = flag.String("appdash-addr", "", "Enable Appdash tracing via an Appdash server host:port")
-		method         = fs.String("method", "ping", "ping")
+		httpAddr             = fs.String("http-addr", "", "HTTP address of hackersvc")
+		grpcAddr             = fs.String("grpc-addr", "", "gRPC address of hackersvc")
+		thriftAddr           = fs.String("thrift-addr", "", "Thrift address of hackersvc")
+		thriftProtocol       = fs.String("thrift-protocol", "binary", "binary, compact, json, simplejson, header")
+		thriftBuffer         = fs.Int("thrift-buffer", 0, "0 for unbuffered")
+		thriftFramed         = fs.Bool("thrift-framed", false, "true to enable framing")
+		thriftTLS            = fs.Bool("thrift-tls", false, "connect to -thrift-addr over TLS via thrift.NewTSSLSocket")
+		thriftTLSCA          = fs.String("thrift-tls-ca", "", "PEM file of CA certificates trusted for the -thrift-tls server certificate; system roots if empty")
+		thriftTLSCert        = fs.String("thrift-tls-cert", "", "PEM client certificate for -thrift-tls, for mutual TLS")
+		thriftTLSKey         = fs.String("thrift-tls-key", "", "PEM private key matching -thrift-tls-cert")
+		thriftHTTPURL        = fs.String("thrift-http-url", "", "Thrift-over-HTTP URL of hackersvc, via thrift.NewTHttpClient; takes precedence over -thrift-addr")
+		discoveryTransport   = fs.String("transport", "http", "transport to use with -consul-addr, -dnssrv, or -etcd-addrs: http, grpc, or thrift")
+		consulAddr           = fs.String("consul-addr", "", "Consul agent address; discover hackersvc instances registered under -consul-service")
+		consulService        = fs.String("consul-service", "hackersvc", "service name to look up in Consul")
+		consulTags           = fs.String("consul-tags", "", "comma-separated tags to filter the Consul lookup by")
+		dnssrvName           = fs.String("dnssrv", "", "DNS SRV name to discover hackersvc instances from, e.g. hackersvc.service.consul")
+		dnssrvTTL            = fs.Duration("dnssrv-ttl", 5*time.Second, "how often to re-resolve -dnssrv")
+		etcdAddrs            = fs.String("etcd-addrs", "", "comma-separated etcd cluster addresses; discover hackersvc instances registered under -etcd-prefix")
+		etcdPrefix           = fs.String("etcd-prefix", "/services/hackersvc/", "etcd key prefix to look up instances under")
+		lbStrategy           = fs.String("lb", "round-robin", "load-balancing strategy for discovered instances: round-robin or random")
+		retryMax             = fs.Int("retry-max", hackertransport.DefaultRetryParams.Max, "max attempts per call against discovered instances")
+		retryTimeout         = fs.Duration("retry-timeout", hackertransport.DefaultRetryParams.Timeout, "max total time per call against discovered instances")
+		clientQPS            = fs.Float64("client.qps", 1, "outbound QPS this client applies per remote instance, across all methods; with service discovery, each method has its own limit per instance")
+		clientBreakerTimeout = fs.Duration("client.breaker-timeout", 30*time.Second, "how long each method's circuit breaker stays open after tripping")
+		zipkinV2URL          = fs.String("zipkin-v2-url", "", "Enable Zipkin tracing via a v2 reporter URL e.g. http://localhost:9411/api/v2/spans")
+		zipkinBridge         = fs.Bool("zipkin-bridge", true, "bridge the native Zipkin tracer through OpenTracing via zipkinot.Wrap for B3 propagation; false leaves tracing unwired")
+		zipkinSampleRate     = fs.Float64("zipkin-sample-rate", 1, "fraction of traces to sample when -zipkin-v2-url is set")
+		lightstepToken       = flag.String("lightstep-token", "", "Enable LightStep tracing via a LightStep access token")
+		appdashAddr          = flag.String("appdash-addr", "", "Enable Appdash tracing via an Appdash server host:port")
+		otelExporter         = fs.String("otel-exporter", "", "Enable OpenTelemetry tracing via an exporter: otlp, jaeger, or stdout")
+		otelEndpoint         = fs.String("otel-endpoint", "", "collector endpoint for -otel-exporter=otlp (gRPC) or jaeger (HTTP Thrift)")
+		method               = fs.String("method", "ping", "ping")
 	)
 	fs.Usage = usageFor(fs, os.Args[0]+" [flags] [<arg>...]")
 	fs.Parse(os.Args[1:])
@@ -49,25 +88,44 @@ func main() {
 	// it.
 	var tracer stdopentracing.Tracer
 	{
-		if *zipkinURL != "" {
-			collector, err := zipkin.NewHTTPCollector(*zipkinURL)
+		if *zipkinV2URL != "" {
+			var (
+				hostPort    = "localhost:80"
+				serviceName = "hackersvc"
+			)
+			reporter := zipkinhttp.NewReporter(*zipkinV2URL)
+			defer reporter.Close()
+
+			sampler, err := zipkin.NewCountingSampler(*zipkinSampleRate)
 			if err != nil {
 				fmt.Fprintln(os.Stderr, err.Error())
 				os.Exit(1)
 			}
-			defer collector.Close()
 
-			var (
-				debug       = false
-				hostPort    = "localhost:80"
-				serviceName = "hackersvc"
+			localEndpoint, err := zipkin.NewEndpoint(serviceName, hostPort)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+
+			nativeTracer, err := zipkin.NewTracer(
+				reporter,
+				zipkin.WithLocalEndpoint(localEndpoint),
+				zipkin.WithSampler(sampler),
 			)
-			recorder := zipkin.NewRecorder(collector, debug, hostPort, serviceName)
-			tracer, err = zipkin.NewTracer(recorder)
 			if err != nil {
 				fmt.Fprintln(os.Stderr, err.Error())
 				os.Exit(1)
 			}
+
+			// zipkinot.Wrap bridges the native tracer's B3 propagation into
+			// the stdopentracing.Tracer API the rest of this binary, and
+			// the gRPC/HTTP/Thrift server middlewares, are built against.
+			if *zipkinBridge {
+				tracer = zipkinot.Wrap(nativeTracer)
+			} else {
+				tracer = stdopentracing.GlobalTracer() // no-op
+			}
 		} else if *lightstepToken != "" {
 			tracer = lightstep.NewTracer(lightstep.Options{
 				AccessToken: *lightstepToken,
@@ -80,23 +138,97 @@ func main() {
 		}
 	}
 
+	// tp is independent of tracer: OpenTracing and OpenTelemetry are wired
+	// side by side rather than bridged, same as the server's
+	// hackerendpoint.New(svc, logger, metrics, tracer, tp) split.
+	var tp oteltrace.TracerProvider = oteltrace.NewNoopTracerProvider()
+	{
+		switch *otelExporter {
+		case "otlp":
+			exporter, err := otlptracegrpc.New(
+				context.Background(),
+				otlptracegrpc.WithEndpoint(*otelEndpoint),
+				otlptracegrpc.WithInsecure(),
+			)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+			sdktp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+			defer sdktp.Shutdown(context.Background())
+			tp = sdktp
+		case "jaeger":
+			exporter, err := jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(*otelEndpoint)))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+			sdktp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+			defer sdktp.Shutdown(context.Background())
+			tp = sdktp
+		case "stdout":
+			exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+			sdktp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+			defer sdktp.Shutdown(context.Background())
+			tp = sdktp
+		case "":
+			// no-op tp, left as the default above
+		default:
+			fmt.Fprintf(os.Stderr, "error: invalid -otel-exporter %q\n", *otelExporter)
+			os.Exit(1)
+		}
+	}
+
+	logger := log.NewNopLogger()
+	retry := hackertransport.RetryParams{Max: *retryMax, Timeout: *retryTimeout}
+	clientOpts := []hackertransport.ClientOption{
+		hackertransport.WithClientRateLimit(*clientQPS, 100),
+		hackertransport.WithCircuitBreaker(gobreaker.Settings{Timeout: *clientBreakerTimeout}),
+	}
+
 	// Again, we try out a couple of transports here, but we'll probably just
 	// stick with one in the end.
 	var (
 		svc hackerservice.Service
 		err error
 	)
-	if *httpAddr != "" {
-		svc, err = hackertransport.NewHTTPClient(*httpAddr, tracer, log.NewNopLogger())
-	} else if *grpcAddr != "" {
-		conn, err := grpc.Dial(*grpcAddr, grpc.WithInsecure(), grpc.WithTimeout(time.Second))
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "error: %v", err)
+	switch {
+	case *consulAddr != "":
+		var tags []string
+		if *consulTags != "" {
+			tags = strings.Split(*consulTags, ",")
+		}
+		instancer, ierr := consul.NewInstancer(*consulAddr, *consulService, tags, logger)
+		if ierr != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", ierr)
+			os.Exit(1)
+		}
+		svc = discoveredService(instancer, *discoveryTransport, tracer, tp, logger, retry, *lbStrategy, thrift.NewTBinaryProtocolFactoryDefault(), thrift.NewTTransportFactory(), clientOpts...)
+	case *dnssrvName != "":
+		instancer := dnssrv.NewInstancer(*dnssrvName, *dnssrvTTL, logger)
+		svc = discoveredService(instancer, *discoveryTransport, tracer, tp, logger, retry, *lbStrategy, thrift.NewTBinaryProtocolFactoryDefault(), thrift.NewTTransportFactory(), clientOpts...)
+	case *etcdAddrs != "":
+		instancer, ierr := etcdv3.NewInstancer(context.Background(), strings.Split(*etcdAddrs, ","), *etcdPrefix, logger)
+		if ierr != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", ierr)
+			os.Exit(1)
+		}
+		svc = discoveredService(instancer, *discoveryTransport, tracer, tp, logger, retry, *lbStrategy, thrift.NewTBinaryProtocolFactoryDefault(), thrift.NewTTransportFactory(), clientOpts...)
+	case *httpAddr != "":
+		svc, err = hackertransport.NewHTTPClient(*httpAddr, tracer, propagation.TraceContext{}, tp, logger, clientOpts...)
+	case *grpcAddr != "":
+		conn, cerr := grpc.Dial(*grpcAddr, grpc.WithInsecure(), grpc.WithTimeout(time.Second), hackertransport.GRPCDialOption(tp))
+		if cerr != nil {
+			fmt.Fprintf(os.Stderr, "error: %v", cerr)
 			os.Exit(1)
 		}
 		defer conn.Close()
-		svc = hackertransport.NewGRPCClient(conn, tracer, log.NewNopLogger())
-	} else if *thriftAddr != "" {
+		svc = hackertransport.NewGRPCClient(conn, tracer, logger, clientOpts...)
+	case *thriftHTTPURL != "" || *thriftAddr != "":
 		var protocolFactory thrift.TProtocolFactory
 		switch *thriftProtocol {
 		case "compact":
@@ -105,6 +237,8 @@ func main() {
 			protocolFactory = thrift.NewTSimpleJSONProtocolFactory()
 		case "json":
 			protocolFactory = thrift.NewTJSONProtocolFactory()
+		case "header":
+			protocolFactory = thrift.NewTHeaderProtocolFactory()
 		case "binary", "":
 			protocolFactory = thrift.NewTBinaryProtocolFactoryDefault()
 		default:
@@ -120,14 +254,27 @@ func main() {
 		if *thriftFramed {
 			transportFactory = thrift.NewTFramedTransportFactory(transportFactory)
 		}
-		transportSocker, err := thrift.NewTSocket(*thriftAddr)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		var transportSocker thrift.TTransport
+		var terr error
+		switch {
+		case *thriftHTTPURL != "":
+			transportSocker, terr = thrift.NewTHttpClient(*thriftHTTPURL)
+		case *thriftTLS:
+			var cfg *tls.Config
+			cfg, terr = thriftTLSConfig(*thriftTLSCA, *thriftTLSCert, *thriftTLSKey)
+			if terr == nil {
+				transportSocker, terr = thrift.NewTSSLSocket(*thriftAddr, cfg)
+			}
+		default:
+			transportSocker, terr = thrift.NewTSocket(*thriftAddr)
+		}
+		if terr != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", terr)
 			os.Exit(1)
 		}
-		transport, err := transportFactory.GetTransport(transportSocker)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		transport, terr := transportFactory.GetTransport(transportSocker)
+		if terr != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", terr)
 			os.Exit(1)
 		}
 		if err := transport.Open(); err != nil {
@@ -136,9 +283,9 @@ func main() {
 		}
 		defer transport.Close()
 		client := hackerthrift.NewHackerServiceClientFactory(transport, protocolFactory)
-		svc = hackertransport.NewThriftClient(client)
-	} else {
-		fmt.Fprintf(os.Stderr, "error: no remote address specified\n")
+		svc = hackertransport.NewThriftClient(client, tracer, logger, clientOpts...)
+	default:
+		fmt.Fprintf(os.Stderr, "error: no remote address or discovery target specified\n")
 		os.Exit(1)
 	}
 	if err != nil {
@@ -160,6 +307,81 @@ func main() {
 	}
 }
 
+// discoveredService builds a hackerservice.Service backed by a
+// continuously-updated instancer instead of a fixed address: it picks the
+// MethodFactories for transport, wraps them with lbStrategy and retry via
+// hackertransport.NewDiscoverySet, and exits the process on an
+// unrecognized transport. protocolFactory and transportFactory are only
+// used when transport is "thrift". opts are forwarded to the underlying
+// per-instance clients built by the chosen MethodFactories constructor.
+// tp is only consulted for the http and grpc transports; Thrift tracing
+// isn't wired up to OpenTelemetry yet.
+func discoveredService(
+	instancer sd.Instancer,
+	transport string,
+	tracer stdopentracing.Tracer,
+	tp oteltrace.TracerProvider,
+	logger log.Logger,
+	retry hackertransport.RetryParams,
+	lbStrategy string,
+	protocolFactory thrift.TProtocolFactory,
+	transportFactory thrift.TTransportFactory,
+	opts ...hackertransport.ClientOption,
+) hackerservice.Service {
+	var factories hackertransport.MethodFactories
+	switch transport {
+	case "http":
+		factories = hackertransport.HTTPMethodFactories(tracer, propagation.TraceContext{}, tp, logger, opts...)
+	case "grpc":
+		factories = hackertransport.GRPCMethodFactories(tracer, tp, logger, opts...)
+	case "thrift":
+		factories = hackertransport.ThriftMethodFactories(protocolFactory, transportFactory, tracer, logger, opts...)
+	default:
+		fmt.Fprintf(os.Stderr, "error: invalid -transport %q\n", transport)
+		os.Exit(1)
+	}
+
+	var balancer hackertransport.Balancer
+	switch lbStrategy {
+	case "round-robin":
+		balancer = hackertransport.RoundRobin
+	case "random":
+		balancer = hackertransport.Random
+	default:
+		fmt.Fprintf(os.Stderr, "error: invalid -lb %q\n", lbStrategy)
+		os.Exit(1)
+	}
+
+	return hackertransport.NewDiscoverySet(context.Background(), instancer, factories, balancer, retry, logger)
+}
+
+// thriftTLSConfig builds the *tls.Config for -thrift-tls from the
+// -thrift-tls-ca/-thrift-tls-cert/-thrift-tls-key flags. ca may be empty,
+// in which case the system root CAs are trusted; cert and key must either
+// both be set, for mutual TLS, or both be empty.
+func thriftTLSConfig(ca, cert, key string) (*tls.Config, error) {
+	cfg := &tls.Config{}
+	if ca != "" {
+		pem, err := ioutil.ReadFile(ca)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", ca)
+		}
+		cfg.RootCAs = pool
+	}
+	if cert != "" || key != "" {
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{pair}
+	}
+	return cfg, nil
+}
+
 func usageFor(fs *flag.FlagSet, short string) func() {
 	return func() {
 		fmt.Fprintf(os.Stderr, "USAGE\n")
@@ -8,6 +8,9 @@ import (
 	"testing"
 
 	"github.com/opentracing/opentracing-go"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/metrics/discard"
@@ -18,9 +21,18 @@ import (
 )
 
 func TestHTTP(t *testing.T) {
-	svc := hackerservice.New(log.NewNopLogger(), discard.NewCounter)
-	eps := hackerendpoint.New(svc, log.NewNopLogger(), discard.NewHistogram, opentracing.GlobalTracer())
-	mux := hackertransport.NewHTTPHandler(eps, opentracing.GlobalTracer(), log.NewNopLogger())
+	metrics := hackerservice.Metrics{
+		RequestCount:   discard.NewCounter(),
+		RequestLatency: discard.NewHistogram(),
+		ErrorCount:     discard.NewCounter(),
+	}
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	propagator := propagation.TraceContext{}
+
+	svc := hackerservice.New(log.NewNopLogger(), metrics)
+	eps := hackerendpoint.New(svc, log.NewNopLogger(), metrics, opentracing.GlobalTracer(), tp)
+	mux := hackertransport.NewHTTPHandler(eps, opentracing.GlobalTracer(), propagator, log.NewNopLogger())
 	srv := httptest.NewServer(mux)
 	defer srv.Close()
 
@@ -29,11 +41,15 @@ func TestHTTP(t *testing.T) {
 	}{
 		{"GET", srv.URL + "/ping", `{}`, `{"p":"PONG"}`},
 	} {
-		req, _ := http.NewRequest(testcase.method, testcase.url, strings.NewReader(testcase.Body))
+		req, _ := http.NewRequest(testcase.method, testcase.url, strings.NewReader(testcase.body))
 		resp, _ := http.DefaultClient.Do(req)
 		body, _ := ioutil.ReadAll(resp.Body)
-		if want, have := testcase.want, strings.Trimspace(string(body)); want != have {
+		if want, have := testcase.want, strings.TrimSpace(string(body)); want != have {
 			t.Errorf("%s %s %s: want %q, have %q", testcase.method, testcase.url, testcase.body, want, have)
 		}
 	}
+
+	if spans := exporter.GetSpans(); len(spans) == 0 {
+		t.Error("expected at least one span to be exported, got none")
+	}
 }
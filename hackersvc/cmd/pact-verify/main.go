@@ -0,0 +1,60 @@
+// Command pact-verify boots hackertransport's HTTP handler over a
+// deterministic stub of hackerservice.Service, so the pacts recorded by
+// hackersvc/pact can be replayed against it independently of go test --
+// e.g. with the standalone pact-provider-verifier CLI, or against a pact
+// broker. TestProviderVerification, in provider_test.go, drives the same
+// handler through pact-go instead, so `go test ./...` catches a broken
+// contract without any of this.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"go.opentelemetry.io/otel/propagation"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics/discard"
+
+	"github.com/ctfsys/backend/hackersvc/pkg/hackerendpoint"
+	"github.com/ctfsys/backend/hackersvc/pkg/hackerservice"
+	"github.com/ctfsys/backend/hackersvc/pkg/hackertransport"
+)
+
+func main() {
+	fs := flag.NewFlagSet("pact-verify", flag.ExitOnError)
+	var (
+		httpAddr = fs.String("http-addr", ":8081", "address to serve the stubbed provider on")
+	)
+	fs.Parse(os.Args[1:])
+
+	logger := log.NewLogfmtLogger(os.Stderr)
+
+	handler := newProviderHandlerFor(newProviderStub(), logger)
+
+	logger.Log("msg", "serving stubbed provider for pact verification", "addr", *httpAddr)
+	if err := http.ListenAndServe(*httpAddr, handler); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// newProviderHandlerFor wires the same middleware chain hackersvc's real
+// binaries would, but over svc instead of hackerservice.NewBasicService,
+// and with tracing/metrics left as no-ops: pact verification cares about
+// request/response shapes, not telemetry. It takes svc rather than
+// constructing its own providerStub so provider_test.go can reach into
+// the stub to satisfy pact provider states.
+func newProviderHandlerFor(svc hackerservice.Service, logger log.Logger) http.Handler {
+	metrics := hackerservice.Metrics{
+		RequestCount:   discard.NewCounter(),
+		RequestLatency: discard.NewHistogram(),
+		ErrorCount:     discard.NewCounter(),
+	}
+	eps := hackerendpoint.New(svc, logger, metrics, stdopentracing.NoopTracer{}, oteltrace.NewNoopTracerProvider())
+	return hackertransport.NewHTTPHandler(eps, stdopentracing.NoopTracer{}, propagation.TraceContext{}, logger)
+}
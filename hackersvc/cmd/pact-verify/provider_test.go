@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pact-foundation/pact-go/dsl"
+	"github.com/pact-foundation/pact-go/types"
+
+	"github.com/ctfsys/backend/hackersvc/pact"
+)
+
+// TestProviderVerification is the provider-side half of hackersvc's
+// contract tests: it records the same interactions pact.Record records
+// against the real hackertransport HTTP client, then replays them
+// against newProviderHandlerFor's stub and fails if a response has
+// drifted from what the consumer expects. It records its own pact file
+// rather than relying on pact.TestConsumerPacts having already written
+// one, since go test gives no ordering guarantee across packages.
+func TestProviderVerification(t *testing.T) {
+	if err := pact.Record(); err != nil {
+		t.Fatalf("recording pact: %v", err)
+	}
+
+	stub := newProviderStub()
+	server := httptest.NewServer(newProviderHandlerFor(stub, log.NewNopLogger()))
+	defer server.Close()
+
+	pactFile := filepath.Join(pact.PactDir, pact.Consumer+"-"+pact.Provider+".json")
+
+	verifier := dsl.Pact{
+		Consumer: pact.Consumer,
+		Provider: pact.Provider,
+	}
+
+	if _, err := verifier.VerifyProvider(t, types.VerifyRequest{
+		ProviderBaseURL: server.URL,
+		PactURLs:        []string{pactFile},
+		StateHandlers: types.StateHandlers{
+			"challenge welcome exists":          func() error { return nil },
+			"user alice has not solved welcome": func() error { return nil },
+			"user alice has solved welcome": func() error {
+				stub.markSolved("alice", "welcome")
+				return nil
+			},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ctfsys/backend/hackersvc/pkg/hackerservice"
+)
+
+// providerStub is a deterministic hackerservice.Service used only for
+// provider verification: unlike hackerservice.NewBasicService, Ping never
+// fails at random and the fixture data is exactly what the interactions in
+// pact/record.go promise, so the only thing under test is whether hackertransport's HTTP
+// encoding still matches the pacts recorded against it.
+type providerStub struct {
+	mtx    sync.RWMutex
+	solved map[string]map[string]bool // user -> challengeID -> solved
+}
+
+func newProviderStub() *providerStub {
+	return &providerStub{solved: map[string]map[string]bool{}}
+}
+
+func (s *providerStub) Ping(_ context.Context) (string, error) {
+	return "pong", nil
+}
+
+func (s *providerStub) ListChallenges(_ context.Context) ([]hackerservice.Challenge, error) {
+	return []hackerservice.Challenge{welcomeChallenge}, nil
+}
+
+func (s *providerStub) GetChallenge(_ context.Context, id string) (hackerservice.Challenge, error) {
+	if id != welcomeChallenge.ID {
+		return hackerservice.Challenge{}, hackerservice.ErrNotFound
+	}
+	return welcomeChallenge, nil
+}
+
+func (s *providerStub) SubmitFlag(_ context.Context, challengeID, user, flag string) (bool, error) {
+	if user == "" {
+		return false, hackerservice.ErrUnauthorized
+	}
+	if challengeID != welcomeChallenge.ID {
+		return false, hackerservice.ErrNotFound
+	}
+	if flag == "" {
+		return false, hackerservice.ErrInvalidFlag
+	}
+	if flag != welcomeFlag {
+		return false, nil
+	}
+
+	s.markSolved(user, challengeID)
+	return true, nil
+}
+
+func (s *providerStub) GetScoreboard(_ context.Context) ([]hackerservice.ScoreboardEntry, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var entries []hackerservice.ScoreboardEntry
+	for user, challenges := range s.solved {
+		points := 0
+		for challengeID, ok := range challenges {
+			if ok && challengeID == welcomeChallenge.ID {
+				points += welcomeChallenge.Points
+			}
+		}
+		entries = append(entries, hackerservice.ScoreboardEntry{User: user, Points: points})
+	}
+	return entries, nil
+}
+
+// welcomeChallenge mirrors the "welcome" challenge the interactions in
+// pact/record.go exercise; it intentionally omits the flag field hackerservice.Challenge
+// never serializes.
+var welcomeChallenge = hackerservice.Challenge{
+	ID:          "welcome",
+	Title:       "Welcome",
+	Category:    "misc",
+	Points:      50,
+	Description: "Submit the flag printed on the landing page.",
+}
+
+// welcomeFlag is the correct flag for welcomeChallenge, matching the one
+// hackerservice.NewBasicService seeds for the real "welcome" challenge.
+const welcomeFlag = "flag{welcome}"
+
+// markSolved implements the "user alice has solved welcome" provider state:
+// it's registered as a pact StateHandler in provider_test.go.
+func (s *providerStub) markSolved(user, challengeID string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.solved[user] == nil {
+		s.solved[user] = map[string]bool{}
+	}
+	s.solved[user][challengeID] = true
+}
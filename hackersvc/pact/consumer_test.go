@@ -0,0 +1,15 @@
+package pact
+
+import "testing"
+
+// TestConsumerPacts records at least one pact interaction per
+// hackerendpoint method (two for SubmitFlag) and writes them to PactDir. It's a first-class go test: if
+// hackertransport's HTTP client stops sending what the provider expects,
+// or stops being able to parse what the provider promises to send back,
+// this test fails right here instead of silently drifting out of sync
+// with cmd/pact-verify.
+func TestConsumerPacts(t *testing.T) {
+	if err := Record(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,212 @@
+// Package pact holds the consumer side of hackersvc's contract tests: for
+// every hackerendpoint method, it drives hackertransport's HTTP client
+// against a pact mock server and records the resulting pact file. The
+// provider side lives in cmd/pact-verify, which replays the recorded
+// pact files against a stubbed hackerservice.Service.
+package pact
+
+import (
+	"context"
+	"fmt"
+
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"go.opentelemetry.io/otel/propagation"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pact-foundation/pact-go/dsl"
+
+	"github.com/ctfsys/backend/hackersvc/pkg/hackerendpoint"
+	"github.com/ctfsys/backend/hackersvc/pkg/hackerservice"
+	"github.com/ctfsys/backend/hackersvc/pkg/hackertransport"
+)
+
+// Consumer and Provider name the two ends of the contract. The provider
+// test in cmd/pact-verify uses them, together with PactDir, to find the
+// pact file Record writes.
+const (
+	Consumer = "hackersvc"
+	Provider = "hackersvc-provider"
+	PactDir  = "./pacts"
+)
+
+// interactionCase describes one HTTP interaction to record: the pact
+// expectation, and how to exercise it through the real HTTP client so the
+// consumer test fails the moment hackertransport stops producing what the
+// pact promises.
+type interactionCase struct {
+	description string
+	given       string
+	request     dsl.Request
+	response    dsl.Response
+	exercise    func(ctx context.Context, svc hackerservice.Service) error
+}
+
+func interactionCases() []interactionCase {
+	return []interactionCase{
+		{
+			description: "a ping request",
+			request: dsl.Request{
+				Method:  "POST",
+				Path:    "/ping",
+				Headers: map[string]string{"Content-Type": "application/json; charset=utf-8"},
+				Body:    hackerendpoint.PingRequest{},
+			},
+			response: dsl.Response{
+				Status:  200,
+				Headers: map[string]string{"Content-Type": "application/json; charset=utf-8"},
+				Body:    hackerendpoint.PingResponse{P: "pong"},
+			},
+			exercise: func(ctx context.Context, svc hackerservice.Service) error {
+				_, err := svc.Ping(ctx)
+				return err
+			},
+		},
+		{
+			description: "a list-challenges request",
+			request: dsl.Request{
+				Method: "GET",
+				Path:   "/challenges",
+			},
+			response: dsl.Response{
+				Status:  200,
+				Headers: map[string]string{"Content-Type": "application/json; charset=utf-8"},
+				Body: hackerendpoint.ListChallengesResponse{
+					Challenges: []hackerservice.Challenge{
+						{ID: "welcome", Title: "Welcome", Category: "misc", Points: 50, Description: "Submit the flag printed on the landing page."},
+					},
+				},
+			},
+			exercise: func(ctx context.Context, svc hackerservice.Service) error {
+				_, err := svc.ListChallenges(ctx)
+				return err
+			},
+		},
+		{
+			description: "a get-challenge request for an existing challenge",
+			given:       "challenge welcome exists",
+			request: dsl.Request{
+				Method: "GET",
+				Path:   "/challenges/welcome",
+			},
+			response: dsl.Response{
+				Status:  200,
+				Headers: map[string]string{"Content-Type": "application/json; charset=utf-8"},
+				Body: hackerendpoint.GetChallengeResponse{
+					Challenge: hackerservice.Challenge{ID: "welcome", Title: "Welcome", Category: "misc", Points: 50, Description: "Submit the flag printed on the landing page."},
+				},
+			},
+			exercise: func(ctx context.Context, svc hackerservice.Service) error {
+				_, err := svc.GetChallenge(ctx, "welcome")
+				return err
+			},
+		},
+		{
+			description: "a submit-flag request for a wrong flag",
+			given:       "user alice has not solved welcome",
+			request: dsl.Request{
+				Method:  "POST",
+				Path:    "/submit",
+				Headers: map[string]string{"Content-Type": "application/json; charset=utf-8"},
+				Body:    hackerendpoint.SubmitFlagRequest{ChallengeID: "welcome", User: "alice", Flag: "wrong"},
+			},
+			response: dsl.Response{
+				Status:  200,
+				Headers: map[string]string{"Content-Type": "application/json; charset=utf-8"},
+				Body:    hackerendpoint.SubmitFlagResponse{Correct: false},
+			},
+			exercise: func(ctx context.Context, svc hackerservice.Service) error {
+				_, err := svc.SubmitFlag(ctx, "welcome", "alice", "wrong")
+				return err
+			},
+		},
+		{
+			description: "a submit-flag request for the correct flag",
+			given:       "user alice has not solved welcome",
+			request: dsl.Request{
+				Method:  "POST",
+				Path:    "/submit",
+				Headers: map[string]string{"Content-Type": "application/json; charset=utf-8"},
+				Body:    hackerendpoint.SubmitFlagRequest{ChallengeID: "welcome", User: "alice", Flag: "flag{welcome}"},
+			},
+			response: dsl.Response{
+				Status:  200,
+				Headers: map[string]string{"Content-Type": "application/json; charset=utf-8"},
+				Body:    hackerendpoint.SubmitFlagResponse{Correct: true},
+			},
+			exercise: func(ctx context.Context, svc hackerservice.Service) error {
+				_, err := svc.SubmitFlag(ctx, "welcome", "alice", "flag{welcome}")
+				return err
+			},
+		},
+		{
+			description: "a get-scoreboard request",
+			given:       "user alice has solved welcome",
+			request: dsl.Request{
+				Method: "GET",
+				Path:   "/scoreboard",
+			},
+			response: dsl.Response{
+				Status:  200,
+				Headers: map[string]string{"Content-Type": "application/json; charset=utf-8"},
+				Body: hackerendpoint.GetScoreboardResponse{
+					Entries: []hackerservice.ScoreboardEntry{{User: "alice", Points: 50}},
+				},
+			},
+			exercise: func(ctx context.Context, svc hackerservice.Service) error {
+				_, err := svc.GetScoreboard(ctx)
+				return err
+			},
+		},
+	}
+}
+
+// Record drives every interactionCase against a pact mock server and
+// writes the resulting pact file to PactDir. It's exported, in a
+// non-test file, so cmd/pact-verify/provider_test.go can record the pact
+// itself before verifying against it instead of depending on a file
+// TestConsumerPacts already wrote: go test gives no ordering guarantee
+// across packages, so a provider test that only reads a file written by a
+// test in another package would be flaky, or fail outright on an
+// isolated run.
+func Record() error {
+	pact := &dsl.Pact{
+		Port:     6666,
+		Consumer: Consumer,
+		Provider: Provider,
+		PactDir:  PactDir,
+	}
+	defer pact.Teardown()
+
+	for _, ic := range interactionCases() {
+		interaction := pact.AddInteraction()
+		if ic.given != "" {
+			interaction.Given(ic.given)
+		}
+		interaction.
+			UponReceiving(ic.description).
+			WithRequest(ic.request).
+			WillRespondWith(ic.response)
+
+		if err := pact.Verify(func() error {
+			svc, err := hackertransport.NewHTTPClient(
+				"localhost:6666",
+				stdopentracing.NoopTracer{},
+				propagation.TraceContext{},
+				oteltrace.NewNoopTracerProvider(),
+				log.NewNopLogger(),
+			)
+			if err != nil {
+				return err
+			}
+			return ic.exercise(context.Background(), svc)
+		}); err != nil {
+			return fmt.Errorf("%s: %w", ic.description, err)
+		}
+	}
+
+	if err := pact.WritePact(); err != nil {
+		return fmt.Errorf("writing pact file: %w", err)
+	}
+	return nil
+}
@@ -8,44 +8,105 @@ import (
 
 	stdopentracing "github.com/opentracing/opentracing-go"
 	"github.com/sony/gobreaker"
+	oteltrace "go.opentelemetry.io/otel/trace"
 
 	"github.com/go-kit/kit/circuitbreaker"
 	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/log"
-	"github.com/go-kit/kit/metrics"
 	"github.com/go-kit/kit/ratelimit"
 	"github.com/go-kit/kit/tracing/opentracing"
 
 	"github.com/ctfsys/backend/hackersvc/pkg/hackerservice"
+	"github.com/ctfsys/backend/hackersvc/pkg/hackertransport/adaptive"
 )
 
 // Set collects all of the endpoints that compose a hacker service. It's meant to
 // be used as a helper struct, to collect all of the endpoints into a single
 // parameter.
 type Set struct {
-	PingEndpoint endpoint.Endpoint
+	PingEndpoint           endpoint.Endpoint
+	ListChallengesEndpoint endpoint.Endpoint
+	GetChallengeEndpoint   endpoint.Endpoint
+	SubmitFlagEndpoint     endpoint.Endpoint
+	GetScoreboardEndpoint  endpoint.Endpoint
 }
 
 // New returns a Set that wraps the provided server, and wires in all of hte
 // expected endpoint middleware via the various parameters.
+//
+// trace is the opentracing.Tracer used to trace each method.
+//
+// Deprecated: pass stdopentracing.NoopTracer{} and rely on tp instead.
+// opentracing wiring is kept only as a compatibility shim for callers that
+// haven't migrated yet, and will be removed once they have.
 func New(
 	svc hackerservice.Service,
 	logger log.Logger,
-	duration metrics.Histogram,
+	m hackerservice.Metrics,
 	trace stdopentracing.Tracer,
+	tp oteltrace.TracerProvider,
 ) Set {
 	var pingEndpoint endpoint.Endpoint
 	{
 		pingEndpoint = MakePingEndpoint(svc)
 		pingEndpoint = ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), 100))(pingEndpoint)
+		pingEndpoint = adaptive.NewLimiter("Ping").Middleware()(pingEndpoint)
 		pingEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{}))(pingEndpoint)
 		pingEndpoint = opentracing.TraceServer(trace, "Ping")(pingEndpoint)
+		pingEndpoint = TracingMiddleware(tp, "Ping")(pingEndpoint)
 		pingEndpoint = LoggingMiddleware(log.With(logger, "method", "Ping"))(pingEndpoint)
-		pingEndpoint = InstrumentingMiddleware(duration.With("method", "Ping"))(pingEndpoint)
+	}
+
+	var listChallengesEndpoint endpoint.Endpoint
+	{
+		listChallengesEndpoint = MakeListChallengesEndpoint(svc)
+		listChallengesEndpoint = ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), 100))(listChallengesEndpoint)
+		listChallengesEndpoint = adaptive.NewLimiter("ListChallenges").Middleware()(listChallengesEndpoint)
+		listChallengesEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{}))(listChallengesEndpoint)
+		listChallengesEndpoint = opentracing.TraceServer(trace, "ListChallenges")(listChallengesEndpoint)
+		listChallengesEndpoint = TracingMiddleware(tp, "ListChallenges")(listChallengesEndpoint)
+		listChallengesEndpoint = LoggingMiddleware(log.With(logger, "method", "ListChallenges"))(listChallengesEndpoint)
+	}
+
+	var getChallengeEndpoint endpoint.Endpoint
+	{
+		getChallengeEndpoint = MakeGetChallengeEndpoint(svc)
+		getChallengeEndpoint = ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), 100))(getChallengeEndpoint)
+		getChallengeEndpoint = adaptive.NewLimiter("GetChallenge").Middleware()(getChallengeEndpoint)
+		getChallengeEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{}))(getChallengeEndpoint)
+		getChallengeEndpoint = opentracing.TraceServer(trace, "GetChallenge")(getChallengeEndpoint)
+		getChallengeEndpoint = TracingMiddleware(tp, "GetChallenge")(getChallengeEndpoint)
+		getChallengeEndpoint = LoggingMiddleware(log.With(logger, "method", "GetChallenge"))(getChallengeEndpoint)
+	}
+
+	var submitFlagEndpoint endpoint.Endpoint
+	{
+		submitFlagEndpoint = MakeSubmitFlagEndpoint(svc)
+		submitFlagEndpoint = ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), 100))(submitFlagEndpoint)
+		submitFlagEndpoint = adaptive.NewLimiter("SubmitFlag").Middleware()(submitFlagEndpoint)
+		submitFlagEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{}))(submitFlagEndpoint)
+		submitFlagEndpoint = opentracing.TraceServer(trace, "SubmitFlag")(submitFlagEndpoint)
+		submitFlagEndpoint = TracingMiddleware(tp, "SubmitFlag")(submitFlagEndpoint)
+		submitFlagEndpoint = LoggingMiddleware(log.With(logger, "method", "SubmitFlag"))(submitFlagEndpoint)
+	}
+
+	var getScoreboardEndpoint endpoint.Endpoint
+	{
+		getScoreboardEndpoint = MakeGetScoreboardEndpoint(svc)
+		getScoreboardEndpoint = ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), 100))(getScoreboardEndpoint)
+		getScoreboardEndpoint = adaptive.NewLimiter("GetScoreboard").Middleware()(getScoreboardEndpoint)
+		getScoreboardEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{}))(getScoreboardEndpoint)
+		getScoreboardEndpoint = opentracing.TraceServer(trace, "GetScoreboard")(getScoreboardEndpoint)
+		getScoreboardEndpoint = TracingMiddleware(tp, "GetScoreboard")(getScoreboardEndpoint)
+		getScoreboardEndpoint = LoggingMiddleware(log.With(logger, "method", "GetScoreboard"))(getScoreboardEndpoint)
 	}
 
 	return Set{
-		PingEndpoint: pingEndpoint,
+		PingEndpoint:           pingEndpoint,
+		ListChallengesEndpoint: listChallengesEndpoint,
+		GetChallengeEndpoint:   getChallengeEndpoint,
+		SubmitFlagEndpoint:     submitFlagEndpoint,
+		GetScoreboardEndpoint:  getScoreboardEndpoint,
 	}
 }
 
@@ -71,6 +132,86 @@ func MakePingEndpoint(s hackerservice.Service) endpoint.Endpoint {
 	}
 }
 
+// ListChallenges implements the service interface, so Set may be used as a
+// service. This is primarily useful in the context of a client library.
+func (s Set) ListChallenges(ctx context.Context) ([]hackerservice.Challenge, error) {
+	resp, err := s.ListChallengesEndpoint(ctx, ListChallengesRequest{})
+	if err != nil {
+		return nil, err
+	}
+	response := resp.(ListChallengesResponse)
+	return response.Challenges, response.Err
+}
+
+// MakeListChallengesEndpoint constructs a ListChallenges endpoint wrapping the service.
+func MakeListChallengesEndpoint(s hackerservice.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		_ = request.(ListChallengesRequest)
+		challenges, err := s.ListChallenges(ctx)
+		return ListChallengesResponse{Challenges: challenges, Err: err}, nil
+	}
+}
+
+// GetChallenge implements the service interface, so Set may be used as a
+// service. This is primarily useful in the context of a client library.
+func (s Set) GetChallenge(ctx context.Context, id string) (hackerservice.Challenge, error) {
+	resp, err := s.GetChallengeEndpoint(ctx, GetChallengeRequest{ID: id})
+	if err != nil {
+		return hackerservice.Challenge{}, err
+	}
+	response := resp.(GetChallengeResponse)
+	return response.Challenge, response.Err
+}
+
+// MakeGetChallengeEndpoint constructs a GetChallenge endpoint wrapping the service.
+func MakeGetChallengeEndpoint(s hackerservice.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(GetChallengeRequest)
+		c, err := s.GetChallenge(ctx, req.ID)
+		return GetChallengeResponse{Challenge: c, Err: err}, nil
+	}
+}
+
+// SubmitFlag implements the service interface, so Set may be used as a
+// service. This is primarily useful in the context of a client library.
+func (s Set) SubmitFlag(ctx context.Context, challengeID, user, flag string) (bool, error) {
+	resp, err := s.SubmitFlagEndpoint(ctx, SubmitFlagRequest{ChallengeID: challengeID, User: user, Flag: flag})
+	if err != nil {
+		return false, err
+	}
+	response := resp.(SubmitFlagResponse)
+	return response.Correct, response.Err
+}
+
+// MakeSubmitFlagEndpoint constructs a SubmitFlag endpoint wrapping the service.
+func MakeSubmitFlagEndpoint(s hackerservice.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(SubmitFlagRequest)
+		correct, err := s.SubmitFlag(ctx, req.ChallengeID, req.User, req.Flag)
+		return SubmitFlagResponse{Correct: correct, Err: err}, nil
+	}
+}
+
+// GetScoreboard implements the service interface, so Set may be used as a
+// service. This is primarily useful in the context of a client library.
+func (s Set) GetScoreboard(ctx context.Context) ([]hackerservice.ScoreboardEntry, error) {
+	resp, err := s.GetScoreboardEndpoint(ctx, GetScoreboardRequest{})
+	if err != nil {
+		return nil, err
+	}
+	response := resp.(GetScoreboardResponse)
+	return response.Entries, response.Err
+}
+
+// MakeGetScoreboardEndpoint constructs a GetScoreboard endpoint wrapping the service.
+func MakeGetScoreboardEndpoint(s hackerservice.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		_ = request.(GetScoreboardRequest)
+		entries, err := s.GetScoreboard(ctx)
+		return GetScoreboardResponse{Entries: entries, Err: err}, nil
+	}
+}
+
 // Failer is an interface that should be implemented by response types.
 // Response encoders can check if responses are Failer, and if so if they've
 // failed, and if so encode them using a separate write path based on the error.
@@ -89,3 +230,65 @@ type PingResponse struct {
 
 // Failed implements Failer.
 func (r PingResponse) Failed() error { return r.Err }
+
+// ListChallengesRequest collects the request parameters for the
+// ListChallenges method.
+type ListChallengesRequest struct{}
+
+// ListChallengesResponse collects the response values for the
+// ListChallenges method.
+type ListChallengesResponse struct {
+	Challenges []hackerservice.Challenge `json:"challenges"`
+	Err        error                     `json:"-"`
+}
+
+// Failed implements Failer.
+func (r ListChallengesResponse) Failed() error { return r.Err }
+
+// GetChallengeRequest collects the request parameters for the GetChallenge
+// method.
+type GetChallengeRequest struct {
+	ID string `json:"id"`
+}
+
+// GetChallengeResponse collects the response values for the GetChallenge
+// method.
+type GetChallengeResponse struct {
+	Challenge hackerservice.Challenge `json:"challenge"`
+	Err       error                   `json:"-"`
+}
+
+// Failed implements Failer.
+func (r GetChallengeResponse) Failed() error { return r.Err }
+
+// SubmitFlagRequest collects the request parameters for the SubmitFlag
+// method.
+type SubmitFlagRequest struct {
+	ChallengeID string `json:"challenge_id"`
+	User        string `json:"user"`
+	Flag        string `json:"flag"`
+}
+
+// SubmitFlagResponse collects the response values for the SubmitFlag
+// method.
+type SubmitFlagResponse struct {
+	Correct bool  `json:"correct"`
+	Err     error `json:"-"`
+}
+
+// Failed implements Failer.
+func (r SubmitFlagResponse) Failed() error { return r.Err }
+
+// GetScoreboardRequest collects the request parameters for the
+// GetScoreboard method.
+type GetScoreboardRequest struct{}
+
+// GetScoreboardResponse collects the response values for the
+// GetScoreboard method.
+type GetScoreboardResponse struct {
+	Entries []hackerservice.ScoreboardEntry `json:"entries"`
+	Err     error                           `json:"-"`
+}
+
+// Failed implements Failer.
+func (r GetScoreboardResponse) Failed() error { return r.Err }
@@ -0,0 +1,37 @@
+package hackerendpoint
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// TracingMiddleware returns an endpoint middleware that starts a
+// trace.Span named operationName, using a tracer obtained from tp, for
+// every invocation. The error, if any, is recorded on the span before it
+// ends.
+//
+// This is the OpenTelemetry replacement for the per-method
+// opentracing.TraceServer/TraceClient wiring in hackertransport, which is
+// now deprecated in favor of this middleware plus the otelHTTPServerBefore
+// and otelHTTPClientBefore helpers that propagate the span's context
+// across the wire.
+func TracingMiddleware(tp trace.TracerProvider, operationName string) endpoint.Middleware {
+	tracer := tp.Tracer("github.com/ctfsys/backend/hackersvc/pkg/hackerendpoint")
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			ctx, span := tracer.Start(ctx, operationName)
+			defer span.End()
+
+			response, err = next(ctx, request)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			return response, err
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package hackerservice
+
+import (
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Code identifies a typed domain error independently of any transport, so
+// that a client can recover the original error after it's crossed an
+// HTTP, gRPC, or Thrift boundary.
+type Code int
+
+// The complete set of domain error codes. CodeUnknown is the zero value,
+// and is never assigned to a real error.
+const (
+	CodeUnknown Code = iota
+	CodeRandomFailure
+	CodeNotFound
+	CodeInvalidFlag
+	CodeUnauthorized
+	CodeRateLimited
+)
+
+// coder is implemented by every error in this package. Transports use it to
+// pick the status that best represents the error, without needing a
+// switch over every domain error.
+type coder interface {
+	error
+	Code() Code
+	HTTPStatus() int
+	GRPCStatus() *status.Status
+}
+
+// domainError is the concrete type behind every exported error in this
+// package.
+type domainError struct {
+	code       Code
+	msg        string
+	httpStatus int
+	grpcCode   codes.Code
+}
+
+func (e *domainError) Error() string { return e.msg }
+
+func (e *domainError) Code() Code { return e.code }
+
+func (e *domainError) HTTPStatus() int { return e.httpStatus }
+
+func (e *domainError) GRPCStatus() *status.Status { return status.New(e.grpcCode, e.msg) }
+
+// Is lets errors.Is match any domainError against target by code rather
+// than by identity. CodeToError itself returns the package-level sentinel,
+// so an error it reconstructs is also equal to that sentinel.
+func (e *domainError) Is(target error) bool {
+	other, ok := target.(*domainError)
+	return ok && other.code == e.code
+}
+
+var (
+	// ErrRandomFailure is returned when the Service randomly fails.
+	// It's meant to just demonstrate error handling.
+	ErrRandomFailure = &domainError{code: CodeRandomFailure, msg: "random failure", httpStatus: http.StatusTeapot, grpcCode: codes.Unavailable}
+
+	// ErrNotFound is returned when a challenge doesn't exist.
+	ErrNotFound = &domainError{code: CodeNotFound, msg: "challenge not found", httpStatus: http.StatusNotFound, grpcCode: codes.NotFound}
+
+	// ErrInvalidFlag is returned when a submitted flag is malformed.
+	ErrInvalidFlag = &domainError{code: CodeInvalidFlag, msg: "invalid flag", httpStatus: http.StatusBadRequest, grpcCode: codes.InvalidArgument}
+
+	// ErrUnauthorized is returned when a request is missing a user identity.
+	ErrUnauthorized = &domainError{code: CodeUnauthorized, msg: "unauthorized", httpStatus: http.StatusUnauthorized, grpcCode: codes.Unauthenticated}
+
+	// ErrRateLimited is returned when a caller has exceeded the service's
+	// rate limit.
+	ErrRateLimited = &domainError{code: CodeRateLimited, msg: "rate limited", httpStatus: http.StatusTooManyRequests, grpcCode: codes.ResourceExhausted}
+)
+
+// codesByCode indexes the sentinel errors above by their wire code, so
+// CodeToError can reconstruct one from a transport that only carries the
+// code, not the Go value.
+var codesByCode = map[Code]error{
+	CodeRandomFailure: ErrRandomFailure,
+	CodeNotFound:      ErrNotFound,
+	CodeInvalidFlag:   ErrInvalidFlag,
+	CodeUnauthorized:  ErrUnauthorized,
+	CodeRateLimited:   ErrRateLimited,
+}
+
+// CodeToError reconstructs the typed domain error identified by code, for
+// use on the receiving end of a transport that carries only the code over
+// the wire. It returns nil for CodeUnknown or any code it doesn't recognize.
+func CodeToError(code Code) error {
+	return codesByCode[code]
+}
+
+// ErrorCode returns the wire code for err, or CodeUnknown if err isn't one
+// of this package's typed domain errors.
+func ErrorCode(err error) Code {
+	if c, ok := err.(coder); ok {
+		return c.Code()
+	}
+	return CodeUnknown
+}
@@ -2,28 +2,59 @@ package hackerservice
 
 import (
 	"context"
-
-	"github.com/go-kit/kit/metrics"
+	"strconv"
+	"time"
 )
 
-// InstrumentingMiddleware returns a service middleware that instruments
-// the number of pings asked for over the lifetime of the service.
-func InstrumentingMiddleware(pings metrics.Counter) Middleware {
+// InstrumentingMiddleware returns a service middleware that records a
+// request count, error count, and request duration for every method call,
+// using the instruments in m.
+func InstrumentingMiddleware(m Metrics) Middleware {
 	return func(next Service) Service {
 		return instrumentingMiddleware{
-			pings: pings,
-			next:  next,
+			metrics: m,
+			next:    next,
 		}
 	}
 }
 
 type instrumentingMiddleware struct {
-	pings metrics.Counter
-	next  Service
+	metrics Metrics
+	next    Service
+}
+
+func (mw instrumentingMiddleware) Ping(ctx context.Context) (p string, err error) {
+	defer func(begin time.Time) { mw.observe("Ping", begin, err) }(time.Now())
+	return mw.next.Ping(ctx)
+}
+
+func (mw instrumentingMiddleware) ListChallenges(ctx context.Context) (challenges []Challenge, err error) {
+	defer func(begin time.Time) { mw.observe("ListChallenges", begin, err) }(time.Now())
+	return mw.next.ListChallenges(ctx)
+}
+
+func (mw instrumentingMiddleware) GetChallenge(ctx context.Context, id string) (c Challenge, err error) {
+	defer func(begin time.Time) { mw.observe("GetChallenge", begin, err) }(time.Now())
+	return mw.next.GetChallenge(ctx, id)
+}
+
+func (mw instrumentingMiddleware) SubmitFlag(ctx context.Context, challengeID, user, flag string) (correct bool, err error) {
+	defer func(begin time.Time) { mw.observe("SubmitFlag", begin, err) }(time.Now())
+	return mw.next.SubmitFlag(ctx, challengeID, user, flag)
 }
 
-func (mw instrumentingMiddleware) Ping(ctx context.Context) (string, error) {
-	p, err := mw.next.Ping(ctx)
-	mw.pings.Add(float64(1))
-	return p, err
+func (mw instrumentingMiddleware) GetScoreboard(ctx context.Context) (entries []ScoreboardEntry, err error) {
+	defer func(begin time.Time) { mw.observe("GetScoreboard", begin, err) }(time.Now())
+	return mw.next.GetScoreboard(ctx)
+}
+
+// observe records the outcome of a single method call: it always counts
+// the request and times it, and additionally counts the error under its
+// domain code, if any.
+func (mw instrumentingMiddleware) observe(method string, begin time.Time, err error) {
+	mw.metrics.RequestCount.With("method", method).Add(1)
+	mw.metrics.RequestLatency.With("method", method).Observe(time.Since(begin).Seconds())
+	if err != nil {
+		mw.metrics.ErrorCount.With("method", method, "code", strconv.Itoa(int(ErrorCode(err)))).Add(1)
+	}
 }
@@ -25,3 +25,31 @@ func (mw loggingMiddleware) Ping(ctx context.Context) (p string, err error) {
 	}()
 	return mw.next.Ping(ctx)
 }
+
+func (mw loggingMiddleware) ListChallenges(ctx context.Context) (challenges []Challenge, err error) {
+	defer func() {
+		mw.logger.Log("method", "ListChallenges", "count", len(challenges), "err", err)
+	}()
+	return mw.next.ListChallenges(ctx)
+}
+
+func (mw loggingMiddleware) GetChallenge(ctx context.Context, id string) (c Challenge, err error) {
+	defer func() {
+		mw.logger.Log("method", "GetChallenge", "id", id, "err", err)
+	}()
+	return mw.next.GetChallenge(ctx, id)
+}
+
+func (mw loggingMiddleware) SubmitFlag(ctx context.Context, challengeID, user, flag string) (correct bool, err error) {
+	defer func() {
+		mw.logger.Log("method", "SubmitFlag", "challenge_id", challengeID, "user", user, "correct", correct, "err", err)
+	}()
+	return mw.next.SubmitFlag(ctx, challengeID, user, flag)
+}
+
+func (mw loggingMiddleware) GetScoreboard(ctx context.Context) (entries []ScoreboardEntry, err error) {
+	defer func() {
+		mw.logger.Log("method", "GetScoreboard", "count", len(entries), "err", err)
+	}()
+	return mw.next.GetScoreboard(ctx)
+}
@@ -0,0 +1,57 @@
+package hackerservice
+
+import (
+	"github.com/go-kit/kit/metrics"
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics collects the instruments InstrumentingMiddleware reports to.
+// Tests that don't care about metrics can build one from
+// github.com/go-kit/kit/metrics/discard.
+type Metrics struct {
+	RequestCount   metrics.Counter
+	RequestLatency metrics.Histogram
+	ErrorCount     metrics.Counter
+}
+
+// With returns a copy of m with every instrument pre-labeled for the given
+// transport (e.g. "http", "grpc", "thrift"). Callers that expose the
+// service over a single transport should bind this once, before passing
+// the result to New, so InstrumentingMiddleware doesn't need to know
+// which transport handled a request.
+func (m Metrics) With(transport string) Metrics {
+	return Metrics{
+		RequestCount:   m.RequestCount.With("transport", transport),
+		RequestLatency: m.RequestLatency.With("transport", transport),
+		ErrorCount:     m.ErrorCount.With("transport", transport),
+	}
+}
+
+// NewPrometheusMetrics builds a Metrics that reports to Prometheus under
+// the given namespace and subsystem. RequestCount and RequestLatency are
+// labeled by method and transport; ErrorCount is additionally labeled by
+// the domain error code, so a dashboard can break failures down by cause.
+func NewPrometheusMetrics(namespace, subsystem string) Metrics {
+	return Metrics{
+		RequestCount: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "request_count",
+			Help:      "Number of requests received.",
+		}, []string{"method", "transport"}),
+		RequestLatency: kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "request_latency_seconds",
+			Help:      "Total duration of requests, in seconds.",
+			Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"method", "transport"}),
+		ErrorCount: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "error_count",
+			Help:      "Number of requests that returned an error, by code.",
+		}, []string{"method", "transport", "code"}),
+	}
+}
@@ -2,43 +2,94 @@ package hackerservice
 
 import (
 	"context"
-	"errors"
 	"math/rand"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
-	"github.com/go-kit/kit/metrics"
 )
 
 // Service describes a service that represents hackers
 type Service interface {
 	// Ping should return "pong" each time
 	Ping(ctx context.Context) (string, error)
+
+	// ListChallenges returns every challenge currently open for submission.
+	ListChallenges(ctx context.Context) ([]Challenge, error)
+
+	// GetChallenge returns a single challenge by ID.
+	GetChallenge(ctx context.Context, id string) (Challenge, error)
+
+	// SubmitFlag checks a flag against a challenge and, if correct, awards
+	// the challenge's points to user. It reports whether the flag was
+	// correct.
+	SubmitFlag(ctx context.Context, challengeID, user, flag string) (bool, error)
+
+	// GetScoreboard returns every user's score, ordered highest first.
+	GetScoreboard(ctx context.Context) ([]ScoreboardEntry, error)
+}
+
+// Challenge describes a single CTF challenge.
+type Challenge struct {
+	ID          string
+	Title       string
+	Category    string
+	Points      int
+	Description string
+	flag        string
+}
+
+// ScoreboardEntry describes a single user's standing on the scoreboard.
+type ScoreboardEntry struct {
+	User   string
+	Points int
 }
 
 // New returns a basic Service with all of the expected middleware wired in.
-func New(logger log.Logger, pings metrics.Counter) Service {
+func New(logger log.Logger, m Metrics) Service {
 	var svc Service
 	{
 		svc = NewBasicService()
 		svc = LoggingMiddleware(logger)(svc)
-		svc = InstrumentingMiddleware(pings)(svc)
+		svc = InstrumentingMiddleware(m)(svc)
 	}
 	return svc
 }
 
-var (
-	// ErrRandomFailure is returned when the Service randomly fails.
-	// It's meant to just demonstrate error handling.
-	ErrRandomFailure = errors.New("random failure")
-)
-
-// NewBasicService returns a naïve, stateless implementation of Service.
+// NewBasicService returns a naïve, in-memory implementation of Service,
+// seeded with a handful of sample challenges.
 func NewBasicService() Service {
-	return basicService{}
+	return &basicService{
+		challenges: map[string]Challenge{
+			"welcome": {
+				ID:          "welcome",
+				Title:       "Welcome",
+				Category:    "misc",
+				Points:      50,
+				Description: "Submit the flag printed on the landing page.",
+				flag:        "flag{welcome}",
+			},
+			"crypto-101": {
+				ID:          "crypto-101",
+				Title:       "Crypto 101",
+				Category:    "crypto",
+				Points:      100,
+				Description: "Decode the base64 blob.",
+				flag:        "flag{base64_is_not_encryption}",
+			},
+		},
+		scores: map[string]int{},
+		solved: map[string]map[string]bool{},
+	}
 }
 
-type basicService struct{}
+type basicService struct {
+	mtx        sync.RWMutex
+	challenges map[string]Challenge
+	scores     map[string]int
+	solved     map[string]map[string]bool // user -> challengeID -> solved
+}
 
 const (
 	// This number says how often our Ping method should fail on purpose.
@@ -51,7 +102,7 @@ const (
 //rand.Seed(time.Now().UnixNano())
 
 // Ping implements Service.
-func (s basicService) Ping(_ context.Context) (string, error) {
+func (s *basicService) Ping(_ context.Context) (string, error) {
 	// TODO(nicolai): do this from main (all mains?)
 	rand.Seed(time.Now().UnixNano())
 
@@ -62,3 +113,78 @@ func (s basicService) Ping(_ context.Context) (string, error) {
 
 	return "pong", nil
 }
+
+// ListChallenges implements Service.
+func (s *basicService) ListChallenges(_ context.Context) ([]Challenge, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	challenges := make([]Challenge, 0, len(s.challenges))
+	for _, c := range s.challenges {
+		c.flag = ""
+		challenges = append(challenges, c)
+	}
+	sort.Slice(challenges, func(i, j int) bool { return challenges[i].ID < challenges[j].ID })
+	return challenges, nil
+}
+
+// GetChallenge implements Service.
+func (s *basicService) GetChallenge(_ context.Context, id string) (Challenge, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	c, ok := s.challenges[id]
+	if !ok {
+		return Challenge{}, ErrNotFound
+	}
+	c.flag = ""
+	return c, nil
+}
+
+// SubmitFlag implements Service.
+func (s *basicService) SubmitFlag(_ context.Context, challengeID, user, flag string) (bool, error) {
+	if user == "" {
+		return false, ErrUnauthorized
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	c, ok := s.challenges[challengeID]
+	if !ok {
+		return false, ErrNotFound
+	}
+	if flag == "" {
+		return false, ErrInvalidFlag
+	}
+	if flag != c.flag {
+		return false, nil
+	}
+
+	if s.solved[user] == nil {
+		s.solved[user] = map[string]bool{}
+	}
+	if !s.solved[user][challengeID] {
+		s.solved[user][challengeID] = true
+		s.scores[user] += c.Points
+	}
+	return true, nil
+}
+
+// GetScoreboard implements Service.
+func (s *basicService) GetScoreboard(_ context.Context) ([]ScoreboardEntry, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	entries := make([]ScoreboardEntry, 0, len(s.scores))
+	for user, points := range s.scores {
+		entries = append(entries, ScoreboardEntry{User: user, Points: points})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Points != entries[j].Points {
+			return entries[i].Points > entries[j].Points
+		}
+		return entries[i].User < entries[j].User
+	})
+	return entries, nil
+}
@@ -0,0 +1,167 @@
+// Package adaptive provides an endpoint middleware that limits concurrent
+// requests to an estimate of what the downstream can sustain, instead of
+// a fixed rate. It's meant to sit alongside, not replace,
+// github.com/go-kit/kit/ratelimit: the fixed limiter is a hard safety
+// cap, while this one adapts to the backend's actual capacity and sheds
+// load before a circuit breaker would trip.
+package adaptive
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/go-kit/kit/endpoint"
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+// overloadedError is returned once in-flight requests reach the current
+// limit plus its queue allowance. It implements the same structural HTTPStatus/GRPCStatus methods
+// hackerservice's domain errors do, so it maps to a sensible status on
+// every transport without either package importing the other.
+type overloadedError struct{}
+
+func (overloadedError) Error() string { return "in-flight request limit exceeded" }
+
+func (overloadedError) HTTPStatus() int { return http.StatusServiceUnavailable }
+
+func (overloadedError) GRPCStatus() *status.Status {
+	return status.New(codes.ResourceExhausted, "in-flight request limit exceeded")
+}
+
+// ErrOverloaded is returned by a Limiter's Middleware in place of calling
+// the wrapped endpoint, once in-flight requests reach the current limit
+// plus its queue allowance.
+var ErrOverloaded error = overloadedError{}
+
+const (
+	initialLimit = 20
+	minLimit     = 1
+	maxLimit     = 1000
+
+	// rttWindow bounds how long rttNoLoad is trusted before it's
+	// refreshed from the next sample, so a limiter that's been running
+	// under sustained load eventually re-probes for a new baseline.
+	rttWindow = 10 * time.Second
+)
+
+var limitGauge = kitprometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+	Namespace: "hackersvc",
+	Subsystem: "adaptive_limiter",
+	Name:      "limit",
+	Help:      "Current estimated in-flight request limit.",
+}, []string{"name"})
+
+// Limiter is an adaptive concurrency limit in the style of Netflix's
+// concurrency-limits Gradient2 algorithm: rather than a fixed rate, it
+// estimates how many in-flight requests the downstream can sustain from
+// the gradient between the best RTT it's seen (rttNoLoad) and each
+// request's own RTT (rttSample), and rejects requests once in-flight
+// exceeds that estimate plus a small queue-size allowance.
+type Limiter struct {
+	gauge kitGauge
+
+	mtx       sync.Mutex
+	limit     float64
+	inFlight  int
+	rttNoLoad time.Duration
+	rttSetAt  time.Time
+}
+
+// kitGauge is the subset of metrics.Gauge the Limiter needs; it's
+// satisfied by the value limitGauge.With returns.
+type kitGauge interface {
+	Set(value float64)
+}
+
+// NewLimiter returns a Limiter that reports its current limit estimate
+// under the Prometheus gauge hackersvc_adaptive_limiter_limit, labeled
+// with name (e.g. the method or client the Limiter guards).
+func NewLimiter(name string) *Limiter {
+	l := &Limiter{limit: initialLimit, gauge: limitGauge.With("name", name)}
+	l.gauge.Set(l.limit)
+	return l
+}
+
+// Limit returns the Limiter's current estimate of sustainable in-flight
+// requests.
+func (l *Limiter) Limit() float64 {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.limit
+}
+
+// Middleware returns an endpoint.Middleware that rejects with
+// ErrOverloaded instead of calling next once in-flight requests reach
+// the limit plus its queue allowance, and updates the limit estimate from each completed
+// request's RTT.
+func (l *Limiter) Middleware() endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			if !l.acquire() {
+				return nil, ErrOverloaded
+			}
+			begin := time.Now()
+			response, err := next(ctx, request)
+			l.release(time.Since(begin))
+			return response, err
+		}
+	}
+}
+
+func (l *Limiter) acquire() bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if float64(l.inFlight) >= l.limit+queueAllowance(l.limit) {
+		return false
+	}
+	l.inFlight++
+	return true
+}
+
+func (l *Limiter) release(rttSample time.Duration) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	l.inFlight--
+
+	now := time.Now()
+	if l.rttNoLoad == 0 || rttSample < l.rttNoLoad || now.Sub(l.rttSetAt) > rttWindow {
+		l.rttNoLoad = rttSample
+		l.rttSetAt = now
+	}
+
+	if rttSample <= 0 {
+		return
+	}
+
+	gradient := l.rttNoLoad.Seconds() / rttSample.Seconds()
+	if gradient > 1 {
+		gradient = 1
+	} else if gradient < 0.5 {
+		gradient = 0.5
+	}
+
+	newLimit := l.limit * gradient
+	if newLimit < minLimit {
+		newLimit = minLimit
+	} else if newLimit > maxLimit {
+		newLimit = maxLimit
+	}
+	l.limit = newLimit
+	l.gauge.Set(l.limit)
+}
+
+// queueAllowance is the number of extra in-flight requests tolerated atop
+// the gradient estimate, so the limiter keeps probing for headroom
+// instead of settling once it's saturated.
+func queueAllowance(limit float64) float64 {
+	return math.Sqrt(limit)
+}
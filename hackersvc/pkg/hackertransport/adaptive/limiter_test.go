@@ -0,0 +1,56 @@
+package adaptive
+
+import (
+	"testing"
+	"time"
+)
+
+// TestReleaseAppliesGradientOnly guards against the queueAllowance bug
+// fixed by d250d12: release must scale the persisted limit by gradient
+// alone, never by gradient plus queueAllowance, or the limit ratchets
+// toward maxLimit instead of tracking the downstream's actual capacity.
+func TestReleaseAppliesGradientOnly(t *testing.T) {
+	l := NewLimiter("test")
+	l.limit = 100
+	l.rttNoLoad = 10 * time.Millisecond
+	l.rttSetAt = time.Now()
+
+	l.release(20 * time.Millisecond) // gradient = 10ms/20ms = 0.5
+
+	if want := 50.0; l.limit != want {
+		t.Errorf("limit = %v, want %v", l.limit, want)
+	}
+}
+
+// TestReleaseClampsToMinLimit checks the lower bound on the gradient-scaled
+// limit.
+func TestReleaseClampsToMinLimit(t *testing.T) {
+	l := NewLimiter("test")
+	l.limit = minLimit + 0.5
+	l.rttNoLoad = 10 * time.Millisecond
+	l.rttSetAt = time.Now()
+
+	l.release(20 * time.Millisecond) // gradient = 0.5, would otherwise dip below minLimit
+
+	if l.limit != minLimit {
+		t.Errorf("limit = %v, want clamped to minLimit %v", l.limit, minLimit)
+	}
+}
+
+// TestAcquireAllowsQueueAllowanceAboveLimit checks that acquire, unlike
+// release, is the one place queueAllowance should apply: it's a transient
+// threshold check, not something folded into the persisted limit.
+func TestAcquireAllowsQueueAllowanceAboveLimit(t *testing.T) {
+	l := NewLimiter("test")
+	l.limit = 10
+
+	threshold := l.limit + queueAllowance(l.limit)
+	for i := 0; float64(i) < threshold; i++ {
+		if !l.acquire() {
+			t.Fatalf("acquire %d: expected success below threshold %v", i, threshold)
+		}
+	}
+	if l.acquire() {
+		t.Errorf("expected acquire to fail once in-flight reaches threshold %v", threshold)
+	}
+}
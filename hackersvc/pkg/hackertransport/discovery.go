@@ -0,0 +1,151 @@
+package hackertransport
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+	"github.com/go-kit/kit/sd/lb"
+
+	"github.com/ctfsys/backend/hackersvc/pkg/hackerendpoint"
+)
+
+// RetryParams configures the retry middleware a load-balanced discovery
+// client applies atop its balancer: up to Max attempts total, bounded by
+// Timeout overall, whichever comes first.
+type RetryParams struct {
+	Max     int
+	Timeout time.Duration
+}
+
+// DefaultRetryParams are used by NewDiscoveryClient and
+// NewDiscoveryClientRandom: 3 attempts, within 500ms in total.
+var DefaultRetryParams = RetryParams{Max: 3, Timeout: 500 * time.Millisecond}
+
+// NewDiscoveryClient builds a single load-balanced, retrying
+// endpoint.Endpoint from a continuously-updated set of service instances.
+// instancer supplies the instances (see the consul and dnssrv subpackages),
+// and factory turns each instance string into a concrete endpoint, the same
+// way NewHTTPClient or NewGRPCClient would for a single instance.
+//
+// The returned endpoint round-robins across healthy instances and retries
+// on failure, per DefaultRetryParams. Callers that want random instance
+// selection should use NewDiscoveryClientRandom, which retries the same
+// way; callers that want a different retry policy, e.g. for methods that
+// shouldn't be retried, should wrap the sd.Endpointer themselves.
+//
+// The instancer is stopped when ctx is canceled.
+func NewDiscoveryClient(ctx context.Context, instancer sd.Instancer, factory sd.Factory, logger log.Logger) endpoint.Endpoint {
+	endpointer := sd.NewEndpointer(instancer, factory, logger)
+	balancer := lb.NewRoundRobin(endpointer)
+	retry := lb.Retry(DefaultRetryParams.Max, DefaultRetryParams.Timeout, balancer)
+
+	go func() {
+		<-ctx.Done()
+		instancer.Stop()
+	}()
+
+	return retry
+}
+
+// NewDiscoveryClientRandom is identical to NewDiscoveryClient, except
+// instances are chosen uniformly at random rather than round-robin. Useful
+// for methods where spreading load matters more than even rotation, e.g.
+// when instances come and go quickly.
+func NewDiscoveryClientRandom(ctx context.Context, instancer sd.Instancer, factory sd.Factory, logger log.Logger) endpoint.Endpoint {
+	endpointer := sd.NewEndpointer(instancer, factory, logger)
+	balancer := lb.NewRandom(endpointer, time.Now().UnixNano())
+	retry := lb.Retry(DefaultRetryParams.Max, DefaultRetryParams.Timeout, balancer)
+
+	go func() {
+		<-ctx.Done()
+		instancer.Stop()
+	}()
+
+	return retry
+}
+
+// Balancer selects which lb.Balancer strategy NewDiscoverySet applies
+// across a method's discovered instances.
+type Balancer int
+
+const (
+	// RoundRobin cycles through instances in turn.
+	RoundRobin Balancer = iota
+	// Random picks a uniformly random instance per call.
+	Random
+)
+
+// MethodFactories collects one sd.Factory per hackerservice.Service
+// method. HTTPMethodFactories, GRPCMethodFactories, and
+// ThriftMethodFactories each build one of these for their transport, for
+// use with NewDiscoverySet.
+type MethodFactories struct {
+	Ping           sd.Factory
+	ListChallenges sd.Factory
+	GetChallenge   sd.Factory
+	SubmitFlag     sd.Factory
+	GetScoreboard  sd.Factory
+}
+
+// NewDiscoverySet builds a hackerendpoint.Set whose every endpoint is
+// load-balanced and retried independently, against the same
+// continuously-updated instancer, using the matching factory out of
+// factories for each method. This is what lets a caller like hackercli
+// point at a service-discovery target instead of a fixed host:port and
+// get a uniform hackerservice.Service back, regardless of transport.
+//
+// balancer picks the strategy used to spread calls across a method's
+// discovered instances; see the Balancer constants.
+//
+// The instancer is stopped exactly once, when ctx is canceled.
+func NewDiscoverySet(ctx context.Context, instancer sd.Instancer, factories MethodFactories, balancer Balancer, retry RetryParams, logger log.Logger) hackerendpoint.Set {
+	balance := func(factory sd.Factory) endpoint.Endpoint {
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		var lbalancer lb.Balancer
+		switch balancer {
+		case Random:
+			lbalancer = lb.NewRandom(endpointer, time.Now().UnixNano())
+		default:
+			lbalancer = lb.NewRoundRobin(endpointer)
+		}
+		return lb.Retry(retry.Max, retry.Timeout, lbalancer)
+	}
+
+	go func() {
+		<-ctx.Done()
+		instancer.Stop()
+	}()
+
+	return hackerendpoint.Set{
+		PingEndpoint:           balance(factories.Ping),
+		ListChallengesEndpoint: balance(factories.ListChallenges),
+		GetChallengeEndpoint:   balance(factories.GetChallenge),
+		SubmitFlagEndpoint:     balance(factories.SubmitFlag),
+		GetScoreboardEndpoint:  balance(factories.GetScoreboard),
+	}
+}
+
+// endpointByMethod picks the endpoint named method out of set. It's used
+// by each transport's MethodFactories constructor: that constructor builds
+// a full single-instance client per discovered instance, of which the
+// load balancer for one method only ever wants the one endpoint back.
+func endpointByMethod(set hackerendpoint.Set, method string) (endpoint.Endpoint, error) {
+	switch method {
+	case "Ping":
+		return set.PingEndpoint, nil
+	case "ListChallenges":
+		return set.ListChallengesEndpoint, nil
+	case "GetChallenge":
+		return set.GetChallengeEndpoint, nil
+	case "SubmitFlag":
+		return set.SubmitFlagEndpoint, nil
+	case "GetScoreboard":
+		return set.GetScoreboardEndpoint, nil
+	default:
+		return nil, fmt.Errorf("hackertransport: unknown method %q", method)
+	}
+}
@@ -2,30 +2,36 @@ package hackertransport
 
 import (
 	"context"
-	"errors"
+	"io"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	stdopentracing "github.com/opentracing/opentracing-go"
 	"github.com/sony/gobreaker"
+	oteltrace "go.opentelemetry.io/otel/trace"
 	oldcontext "golang.org/x/net/context"
-	"golang.org/x/time/rate"
 
-	"github.com/go-kit/kit/circuitbreaker"
 	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/log"
-	"github.com/go-kit/kit/ratelimit"
+	"github.com/go-kit/kit/sd"
 	"github.com/go-kit/kit/tracing/opentracing"
 	grpctransport "github.com/go-kit/kit/transport/grpc"
 
 	"github.com/ctfsys/backend/hackersvc/pb"
 	"github.com/ctfsys/backend/hackersvc/pkg/hackerendpoint"
 	"github.com/ctfsys/backend/hackersvc/pkg/hackerservice"
+	"github.com/ctfsys/backend/hackersvc/pkg/hackertransport/adaptive"
 )
 
 type grpcServer struct {
-	ping grpctransport.Handler
+	ping           grpctransport.Handler
+	listChallenges grpctransport.Handler
+	getChallenge   grpctransport.Handler
+	submitFlag     grpctransport.Handler
+	getScoreboard  grpctransport.Handler
 }
 
 // NewGRPCServer makes a set of endpoints available as a gRPC HackerServer.
@@ -40,6 +46,30 @@ func NewGRPCServer(endpoints hackerendpoint.Set, tracer stdopentracing.Tracer, l
 			encodeGRPCPingResponse,
 			append(options, grpctransport.ServerBefore(opentracing.GRPCToContext(tracer, "Ping", logger)))...,
 		),
+		listChallenges: grpctransport.NewServer(
+			endpoints.ListChallengesEndpoint,
+			decodeGRPCListChallengesRequest,
+			encodeGRPCListChallengesResponse,
+			append(options, grpctransport.ServerBefore(opentracing.GRPCToContext(tracer, "ListChallenges", logger)))...,
+		),
+		getChallenge: grpctransport.NewServer(
+			endpoints.GetChallengeEndpoint,
+			decodeGRPCGetChallengeRequest,
+			encodeGRPCGetChallengeResponse,
+			append(options, grpctransport.ServerBefore(opentracing.GRPCToContext(tracer, "GetChallenge", logger)))...,
+		),
+		submitFlag: grpctransport.NewServer(
+			endpoints.SubmitFlagEndpoint,
+			decodeGRPCSubmitFlagRequest,
+			encodeGRPCSubmitFlagResponse,
+			append(options, grpctransport.ServerBefore(opentracing.GRPCToContext(tracer, "SubmitFlag", logger)))...,
+		),
+		getScoreboard: grpctransport.NewServer(
+			endpoints.GetScoreboardEndpoint,
+			decodeGRPCGetScoreboardRequest,
+			encodeGRPCGetScoreboardResponse,
+			append(options, grpctransport.ServerBefore(opentracing.GRPCToContext(tracer, "GetScoreboard", logger)))...,
+		),
 	}
 }
 
@@ -51,18 +81,57 @@ func (s *grpcServer) Ping(ctx oldcontext.Context, req *pb.PingRequest) (*pb.Ping
 	return rep.(*pb.PingReply), nil
 }
 
+func (s *grpcServer) ListChallenges(ctx oldcontext.Context, req *pb.ListChallengesRequest) (*pb.ListChallengesReply, error) {
+	_, rep, err := s.listChallenges.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return rep.(*pb.ListChallengesReply), nil
+}
+
+func (s *grpcServer) GetChallenge(ctx oldcontext.Context, req *pb.GetChallengeRequest) (*pb.GetChallengeReply, error) {
+	_, rep, err := s.getChallenge.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return rep.(*pb.GetChallengeReply), nil
+}
+
+func (s *grpcServer) SubmitFlag(ctx oldcontext.Context, req *pb.SubmitFlagRequest) (*pb.SubmitFlagReply, error) {
+	_, rep, err := s.submitFlag.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return rep.(*pb.SubmitFlagReply), nil
+}
+
+func (s *grpcServer) GetScoreboard(ctx oldcontext.Context, req *pb.GetScoreboardRequest) (*pb.GetScoreboardReply, error) {
+	_, rep, err := s.getScoreboard.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return rep.(*pb.GetScoreboardReply), nil
+}
+
 // NewGRPCClient returns a HackerService backed by a gRPC server at the other end
 // of the conn. The caller is responsible for constructing the conn, and
 // eventually closing the underlying transport. We bake-in certain middlewares,
 // implementing the client library pattern.
-func NewGRPCClient(conn *grpc.ClientConn, tracer stdopentracing.Tracer, logger log.Logger) hackerservice.Service {
+//
+// opts tune the client's rate limiting and circuit breaking; see
+// WithClientRateLimit and WithCircuitBreaker.
+func NewGRPCClient(conn *grpc.ClientConn, tracer stdopentracing.Tracer, logger log.Logger, opts ...ClientOption) hackerservice.Service {
 	// We construct a single ratelimiter middleware, to limit the total
 	// outgoing QPS from this client to all methods on the remote instance. We
 	// also construct per-endpoint circuitbreaker middlewares, although they
 	// could easily be combined into a single breaker for the entire remote
 	// instance, too.
-	limiter := ratelimit.NewErroringLimiter(rate.NewLimiter(
-		rate.Every(time.Second), 100))
+	options := clientOptions{qps: 1, burst: 100, breaker: gobreaker.Settings{Timeout: 30 * time.Second}}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	limiter := options.limiter()
+	adaptiveLimiter := adaptive.NewLimiter("grpc-client")
 
 	// Each individual endpoint is an http/transport.Client (which implements
 	// endpoint.Endpoint) that gets wrapped with various middleware. If you
@@ -81,16 +150,120 @@ func NewGRPCClient(conn *grpc.ClientConn, tracer stdopentracing.Tracer, logger l
 		).Endpoint()
 		pingEndpoint = opentracing.TraceClient(tracer, "Ping")(pingEndpoint)
 		pingEndpoint = limiter(pingEndpoint)
-		pingEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{
-			Name:    "Ping",
-			Timeout: 30 * time.Second,
-		}))(pingEndpoint)
+		pingEndpoint = adaptiveLimiter.Middleware()(pingEndpoint)
+		pingEndpoint = options.breakerFor("Ping")(pingEndpoint)
+	}
+
+	var listChallengesEndpoint endpoint.Endpoint
+	{
+		listChallengesEndpoint = grpctransport.NewClient(
+			conn,
+			"pb.Hacker",
+			"ListChallenges",
+			encodeGRPCListChallengesRequest,
+			decodeGRPCListChallengesResponse,
+			pb.ListChallengesReply{},
+			grpctransport.ClientBefore(opentracing.ContextToGRPC(tracer, logger)),
+		).Endpoint()
+		listChallengesEndpoint = opentracing.TraceClient(tracer, "ListChallenges")(listChallengesEndpoint)
+		listChallengesEndpoint = limiter(listChallengesEndpoint)
+		listChallengesEndpoint = adaptiveLimiter.Middleware()(listChallengesEndpoint)
+		listChallengesEndpoint = options.breakerFor("ListChallenges")(listChallengesEndpoint)
+	}
+
+	var getChallengeEndpoint endpoint.Endpoint
+	{
+		getChallengeEndpoint = grpctransport.NewClient(
+			conn,
+			"pb.Hacker",
+			"GetChallenge",
+			encodeGRPCGetChallengeRequest,
+			decodeGRPCGetChallengeResponse,
+			pb.GetChallengeReply{},
+			grpctransport.ClientBefore(opentracing.ContextToGRPC(tracer, logger)),
+		).Endpoint()
+		getChallengeEndpoint = opentracing.TraceClient(tracer, "GetChallenge")(getChallengeEndpoint)
+		getChallengeEndpoint = limiter(getChallengeEndpoint)
+		getChallengeEndpoint = adaptiveLimiter.Middleware()(getChallengeEndpoint)
+		getChallengeEndpoint = options.breakerFor("GetChallenge")(getChallengeEndpoint)
+	}
+
+	var submitFlagEndpoint endpoint.Endpoint
+	{
+		submitFlagEndpoint = grpctransport.NewClient(
+			conn,
+			"pb.Hacker",
+			"SubmitFlag",
+			encodeGRPCSubmitFlagRequest,
+			decodeGRPCSubmitFlagResponse,
+			pb.SubmitFlagReply{},
+			grpctransport.ClientBefore(opentracing.ContextToGRPC(tracer, logger)),
+		).Endpoint()
+		submitFlagEndpoint = opentracing.TraceClient(tracer, "SubmitFlag")(submitFlagEndpoint)
+		submitFlagEndpoint = limiter(submitFlagEndpoint)
+		submitFlagEndpoint = adaptiveLimiter.Middleware()(submitFlagEndpoint)
+		submitFlagEndpoint = options.breakerFor("SubmitFlag")(submitFlagEndpoint)
+	}
+
+	var getScoreboardEndpoint endpoint.Endpoint
+	{
+		getScoreboardEndpoint = grpctransport.NewClient(
+			conn,
+			"pb.Hacker",
+			"GetScoreboard",
+			encodeGRPCGetScoreboardRequest,
+			decodeGRPCGetScoreboardResponse,
+			pb.GetScoreboardReply{},
+			grpctransport.ClientBefore(opentracing.ContextToGRPC(tracer, logger)),
+		).Endpoint()
+		getScoreboardEndpoint = opentracing.TraceClient(tracer, "GetScoreboard")(getScoreboardEndpoint)
+		getScoreboardEndpoint = limiter(getScoreboardEndpoint)
+		getScoreboardEndpoint = adaptiveLimiter.Middleware()(getScoreboardEndpoint)
+		getScoreboardEndpoint = options.breakerFor("GetScoreboard")(getScoreboardEndpoint)
 	}
 
 	// Returning the endpoint.Set as a service.Service relies on the
 	// endpoint.Set implementing the Service methods.
 	return hackerendpoint.Set{
-		PingEndpoint: pingEndpoint,
+		PingEndpoint:           pingEndpoint,
+		ListChallengesEndpoint: listChallengesEndpoint,
+		GetChallengeEndpoint:   getChallengeEndpoint,
+		SubmitFlagEndpoint:     submitFlagEndpoint,
+		GetScoreboardEndpoint:  getScoreboardEndpoint,
+	}
+}
+
+// GRPCMethodFactories returns the sd.Factory set for every hackerendpoint
+// method over gRPC, for use with NewDiscoverySet. Each factory dials a
+// fresh *grpc.ClientConn to the discovered instance, builds a
+// single-instance client via NewGRPCClient, and hands the load balancer
+// back just the one endpoint it's responsible for. The ClientConn is
+// returned as the io.Closer, so the balancer closes it once that
+// instance is dropped. opts are forwarded to NewGRPCClient for every
+// instance. tp instruments every dialed connection with OpenTelemetry via
+// GRPCDialOption.
+func GRPCMethodFactories(tracer stdopentracing.Tracer, tp oteltrace.TracerProvider, logger log.Logger, opts ...ClientOption) MethodFactories {
+	factory := func(method string) sd.Factory {
+		return func(instance string) (endpoint.Endpoint, io.Closer, error) {
+			conn, err := grpc.Dial(instance, grpc.WithInsecure(), GRPCDialOption(tp))
+			if err != nil {
+				return nil, nil, err
+			}
+			svc := NewGRPCClient(conn, tracer, logger, opts...)
+			ep, err := endpointByMethod(svc.(hackerendpoint.Set), method)
+			if err != nil {
+				conn.Close()
+				return nil, nil, err
+			}
+			return ep, conn, nil
+		}
+	}
+	return MethodFactories{
+		Ping:           factory("Ping"),
+		ListChallenges: factory("ListChallenges"),
+		GetChallenge:   factory("GetChallenge"),
+		SubmitFlag:     factory("SubmitFlag"),
+		GetScoreboard:  factory("GetScoreboard"),
 	}
 }
 
@@ -109,7 +282,7 @@ func decodeGRPCPingResponse(_ context.Context, grpcReply interface{}) (interface
 	reply := grpcReply.(*pb.PingReply)
 	return hackerendpoint.PingResponse{
 		P:   string(reply.P),
-		Err: str2err(reply.Err),
+		Err: str2err(reply.ErrCode, reply.Err),
 	}, nil
 }
 
@@ -117,7 +290,7 @@ func decodeGRPCPingResponse(_ context.Context, grpcReply interface{}) (interface
 // user-domain ping response to a gRPC ping reply. Primarily useful in a server.
 func encodeGRPCPingResponse(_ context.Context, response interface{}) (interface{}, error) {
 	resp := response.(hackerendpoint.PingResponse)
-	return &pb.PingReply{P: string(resp.P), Err: err2str(resp.Err)}, nil
+	return &pb.PingReply{P: string(resp.P), Err: err2str(resp.Err), ErrCode: errCode(resp.Err)}, nil
 }
 
 // encodeGRPCPingRequest is a transport/grpc.EncodeRequestFunc that converts a
@@ -127,15 +300,193 @@ func encodeGRPCPingRequest(_ context.Context, request interface{}) (interface{},
 	return &pb.PingRequest{}, nil
 }
 
+// decodeGRPCListChallengesRequest is a transport/grpc.DecodeRequestFunc that
+// converts a gRPC list-challenges request to a user-domain request.
+// Primarily useful in a server.
+func decodeGRPCListChallengesRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	_ = grpcReq.(*pb.ListChallengesRequest)
+	return hackerendpoint.ListChallengesRequest{}, nil
+}
+
+// decodeGRPCListChallengesResponse is a transport/grpc.DecodeResponseFunc
+// that converts a gRPC list-challenges reply to a user-domain response.
+// Primarily useful in a client.
+func decodeGRPCListChallengesResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
+	reply := grpcReply.(*pb.ListChallengesReply)
+	challenges := make([]hackerservice.Challenge, len(reply.Challenges))
+	for i, c := range reply.Challenges {
+		challenges[i] = challengeFromProto(c)
+	}
+	return hackerendpoint.ListChallengesResponse{Challenges: challenges, Err: str2err(reply.ErrCode, reply.Err)}, nil
+}
+
+// encodeGRPCListChallengesResponse is a transport/grpc.EncodeResponseFunc
+// that converts a user-domain list-challenges response to a gRPC reply.
+// Primarily useful in a server.
+func encodeGRPCListChallengesResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(hackerendpoint.ListChallengesResponse)
+	challenges := make([]*pb.Challenge, len(resp.Challenges))
+	for i, c := range resp.Challenges {
+		challenges[i] = challengeToProto(c)
+	}
+	return &pb.ListChallengesReply{Challenges: challenges, Err: err2str(resp.Err), ErrCode: errCode(resp.Err)}, nil
+}
+
+// encodeGRPCListChallengesRequest is a transport/grpc.EncodeRequestFunc that
+// converts a user-domain list-challenges request to a gRPC request.
+// Primarily useful in a client.
+func encodeGRPCListChallengesRequest(_ context.Context, request interface{}) (interface{}, error) {
+	_ = request.(hackerendpoint.ListChallengesRequest)
+	return &pb.ListChallengesRequest{}, nil
+}
+
+// decodeGRPCGetChallengeRequest is a transport/grpc.DecodeRequestFunc that
+// converts a gRPC get-challenge request to a user-domain request. Primarily
+// useful in a server.
+func decodeGRPCGetChallengeRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.GetChallengeRequest)
+	return hackerendpoint.GetChallengeRequest{ID: req.Id}, nil
+}
+
+// decodeGRPCGetChallengeResponse is a transport/grpc.DecodeResponseFunc that
+// converts a gRPC get-challenge reply to a user-domain response. Primarily
+// useful in a client.
+func decodeGRPCGetChallengeResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
+	reply := grpcReply.(*pb.GetChallengeReply)
+	return hackerendpoint.GetChallengeResponse{
+		Challenge: challengeFromProto(reply.Challenge),
+		Err:       str2err(reply.ErrCode, reply.Err),
+	}, nil
+}
+
+// encodeGRPCGetChallengeResponse is a transport/grpc.EncodeResponseFunc that
+// converts a user-domain get-challenge response to a gRPC reply. Primarily
+// useful in a server.
+func encodeGRPCGetChallengeResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(hackerendpoint.GetChallengeResponse)
+	return &pb.GetChallengeReply{Challenge: challengeToProto(resp.Challenge), Err: err2str(resp.Err), ErrCode: errCode(resp.Err)}, nil
+}
+
+// encodeGRPCGetChallengeRequest is a transport/grpc.EncodeRequestFunc that
+// converts a user-domain get-challenge request to a gRPC request. Primarily
+// useful in a client.
+func encodeGRPCGetChallengeRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(hackerendpoint.GetChallengeRequest)
+	return &pb.GetChallengeRequest{Id: req.ID}, nil
+}
+
+// decodeGRPCSubmitFlagRequest is a transport/grpc.DecodeRequestFunc that
+// converts a gRPC submit-flag request to a user-domain request. Primarily
+// useful in a server.
+func decodeGRPCSubmitFlagRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.SubmitFlagRequest)
+	return hackerendpoint.SubmitFlagRequest{ChallengeID: req.ChallengeId, User: req.User, Flag: req.Flag}, nil
+}
+
+// decodeGRPCSubmitFlagResponse is a transport/grpc.DecodeResponseFunc that
+// converts a gRPC submit-flag reply to a user-domain response. Primarily
+// useful in a client.
+func decodeGRPCSubmitFlagResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
+	reply := grpcReply.(*pb.SubmitFlagReply)
+	return hackerendpoint.SubmitFlagResponse{Correct: reply.Correct, Err: str2err(reply.ErrCode, reply.Err)}, nil
+}
+
+// encodeGRPCSubmitFlagResponse is a transport/grpc.EncodeResponseFunc that
+// converts a user-domain submit-flag response to a gRPC reply. Primarily
+// useful in a server.
+func encodeGRPCSubmitFlagResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(hackerendpoint.SubmitFlagResponse)
+	return &pb.SubmitFlagReply{Correct: resp.Correct, Err: err2str(resp.Err), ErrCode: errCode(resp.Err)}, nil
+}
+
+// encodeGRPCSubmitFlagRequest is a transport/grpc.EncodeRequestFunc that
+// converts a user-domain submit-flag request to a gRPC request. Primarily
+// useful in a client.
+func encodeGRPCSubmitFlagRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(hackerendpoint.SubmitFlagRequest)
+	return &pb.SubmitFlagRequest{ChallengeId: req.ChallengeID, User: req.User, Flag: req.Flag}, nil
+}
+
+// decodeGRPCGetScoreboardRequest is a transport/grpc.DecodeRequestFunc that
+// converts a gRPC get-scoreboard request to a user-domain request.
+// Primarily useful in a server.
+func decodeGRPCGetScoreboardRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	_ = grpcReq.(*pb.GetScoreboardRequest)
+	return hackerendpoint.GetScoreboardRequest{}, nil
+}
+
+// decodeGRPCGetScoreboardResponse is a transport/grpc.DecodeResponseFunc
+// that converts a gRPC get-scoreboard reply to a user-domain response.
+// Primarily useful in a client.
+func decodeGRPCGetScoreboardResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
+	reply := grpcReply.(*pb.GetScoreboardReply)
+	entries := make([]hackerservice.ScoreboardEntry, len(reply.Entries))
+	for i, e := range reply.Entries {
+		entries[i] = hackerservice.ScoreboardEntry{User: e.User, Points: int(e.Points)}
+	}
+	return hackerendpoint.GetScoreboardResponse{Entries: entries, Err: str2err(reply.ErrCode, reply.Err)}, nil
+}
+
+// encodeGRPCGetScoreboardResponse is a transport/grpc.EncodeResponseFunc
+// that converts a user-domain get-scoreboard response to a gRPC reply.
+// Primarily useful in a server.
+func encodeGRPCGetScoreboardResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(hackerendpoint.GetScoreboardResponse)
+	entries := make([]*pb.ScoreboardEntry, len(resp.Entries))
+	for i, e := range resp.Entries {
+		entries[i] = &pb.ScoreboardEntry{User: e.User, Points: int32(e.Points)}
+	}
+	return &pb.GetScoreboardReply{Entries: entries, Err: err2str(resp.Err), ErrCode: errCode(resp.Err)}, nil
+}
+
+// encodeGRPCGetScoreboardRequest is a transport/grpc.EncodeRequestFunc that
+// converts a user-domain get-scoreboard request to a gRPC request.
+// Primarily useful in a client.
+func encodeGRPCGetScoreboardRequest(_ context.Context, request interface{}) (interface{}, error) {
+	_ = request.(hackerendpoint.GetScoreboardRequest)
+	return &pb.GetScoreboardRequest{}, nil
+}
+
+// challengeToProto converts a user-domain Challenge to its gRPC wire
+// representation.
+func challengeToProto(c hackerservice.Challenge) *pb.Challenge {
+	return &pb.Challenge{
+		Id:          c.ID,
+		Title:       c.Title,
+		Category:    c.Category,
+		Points:      int32(c.Points),
+		Description: c.Description,
+	}
+}
+
+// challengeFromProto converts a gRPC Challenge back to the user-domain type.
+func challengeFromProto(c *pb.Challenge) hackerservice.Challenge {
+	if c == nil {
+		return hackerservice.Challenge{}
+	}
+	return hackerservice.Challenge{
+		ID:          c.Id,
+		Title:       c.Title,
+		Category:    c.Category,
+		Points:      int(c.Points),
+		Description: c.Description,
+	}
+}
+
 // These annoying helper functions are required to translate Go error types to
-// and from strings, which is the type we use in our IDLs to represent errors.
-// There is special casing to treat empty strings as nil errors.
+// and from the wire representation: an error-code field, which lets a
+// client recover the original hackerservice error via
+// hackerservice.CodeToError, plus a message field for anything else.
+// There is special casing to treat empty messages as nil errors.
 
-func str2err(s string) error {
-	if s == "" {
+func str2err(code int32, msg string) error {
+	if msg == "" {
 		return nil
 	}
-	return errors.New(s)
+	if derr := hackerservice.CodeToError(hackerservice.Code(code)); derr != nil {
+		return derr
+	}
+	return status.New(codes.Unknown, msg).Err()
 }
 
 func err2str(err error) string {
@@ -144,3 +495,7 @@ func err2str(err error) string {
 	}
 	return err.Error()
 }
+
+func errCode(err error) int32 {
+	return int32(hackerservice.ErrorCode(err))
+}
@@ -5,31 +5,39 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
 
-	"golang.org/x/time/rate"
-
 	stdopentracing "github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sony/gobreaker"
+	otelpropagation "go.opentelemetry.io/otel/propagation"
+	oteltrace "go.opentelemetry.io/otel/trace"
 
-	"github.com/go-kit/kit/circuitbreaker"
 	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/log"
-	"github.com/go-kit/kit/ratelimit"
+	"github.com/go-kit/kit/sd"
 	"github.com/go-kit/kit/tracing/opentracing"
 	httptransport "github.com/go-kit/kit/transport/http"
 
 	"github.com/ctfsys/backend/hackersvc/pkg/hackerendpoint"
 	"github.com/ctfsys/backend/hackersvc/pkg/hackerservice"
+	"github.com/ctfsys/backend/hackersvc/pkg/hackertransport/adaptive"
 )
 
 // NewHTTPHandler returns an HTTP handler that makes a set of endpoints
 // available on predifined paths.
-func NewHTTPHandler(endpoints hackerendpoint.Set, tracer stdopentracing.Tracer, logger log.Logger) http.Handler {
+//
+// tracer is used for the opentracing wiring.
+//
+// Deprecated: the opentracing.HTTPToContext wiring driven by tracer is
+// kept only as a compatibility shim; propagator, used to extract an
+// OpenTelemetry trace context from incoming requests, is its replacement.
+func NewHTTPHandler(endpoints hackerendpoint.Set, tracer stdopentracing.Tracer, propagator otelpropagation.TextMapPropagator, logger log.Logger) http.Handler {
 	options := []httptransport.ServerOption{
 		httptransport.ServerErrorEncoder(errorEncoder),
 		httptransport.ServerErrorLogger(logger),
@@ -40,9 +48,54 @@ func NewHTTPHandler(endpoints hackerendpoint.Set, tracer stdopentracing.Tracer,
 		endpoints.PingEndpoint,
 		decodeHTTPPingRequest,
 		encodeHTTPGenericResponse,
-		append(options, httptransport.ServerBefore(opentracing.HTTPToContext(tracer, "Ping", logger)))...,
+		append(options,
+			httptransport.ServerBefore(opentracing.HTTPToContext(tracer, "Ping", logger)),
+			httptransport.ServerBefore(otelHTTPServerBefore(propagator)),
+		)...,
+	))
+
+	m.Handle("/challenges", httptransport.NewServer(
+		endpoints.ListChallengesEndpoint,
+		decodeHTTPListChallengesRequest,
+		encodeHTTPGenericResponse,
+		append(options,
+			httptransport.ServerBefore(opentracing.HTTPToContext(tracer, "ListChallenges", logger)),
+			httptransport.ServerBefore(otelHTTPServerBefore(propagator)),
+		)...,
+	))
+
+	m.Handle("/challenges/", httptransport.NewServer(
+		endpoints.GetChallengeEndpoint,
+		decodeHTTPGetChallengeRequest,
+		encodeHTTPGenericResponse,
+		append(options,
+			httptransport.ServerBefore(opentracing.HTTPToContext(tracer, "GetChallenge", logger)),
+			httptransport.ServerBefore(otelHTTPServerBefore(propagator)),
+		)...,
+	))
+
+	m.Handle("/submit", httptransport.NewServer(
+		endpoints.SubmitFlagEndpoint,
+		decodeHTTPSubmitFlagRequest,
+		encodeHTTPGenericResponse,
+		append(options,
+			httptransport.ServerBefore(opentracing.HTTPToContext(tracer, "SubmitFlag", logger)),
+			httptransport.ServerBefore(otelHTTPServerBefore(propagator)),
+		)...,
+	))
+
+	m.Handle("/scoreboard", httptransport.NewServer(
+		endpoints.GetScoreboardEndpoint,
+		decodeHTTPGetScoreboardRequest,
+		encodeHTTPGenericResponse,
+		append(options,
+			httptransport.ServerBefore(opentracing.HTTPToContext(tracer, "GetScoreboard", logger)),
+			httptransport.ServerBefore(otelHTTPServerBefore(propagator)),
+		)...,
 	))
 
+	m.Handle("/metrics", promhttp.Handler())
+
 	return m
 }
 
@@ -50,7 +103,14 @@ func NewHTTPHandler(endpoints hackerendpoint.Set, tracer stdopentracing.Tracer,
 // remote instance. We expect instance to come from a service discovery system,
 // so likely of the form "host:port". We bake-in certain middlewares,
 // implementing the client library pattern.
-func NewHTTPClient(instance string, tracer stdopentracing.Tracer, logger log.Logger) (hackerservice.Service, error) {
+//
+// Deprecated: the opentracing.ContextToHTTP wiring driven by tracer is
+// kept only as a compatibility shim; propagator, used to inject an
+// OpenTelemetry trace context into outgoing requests, is its replacement.
+//
+// opts tune the client's rate limiting and circuit breaking; see
+// WithClientRateLimit and WithCircuitBreaker.
+func NewHTTPClient(instance string, tracer stdopentracing.Tracer, propagator otelpropagation.TextMapPropagator, tp oteltrace.TracerProvider, logger log.Logger, opts ...ClientOption) (hackerservice.Service, error) {
 	// Quickly sanitize the instance string.
 	if !strings.HasPrefix(instance, "http") {
 		instance = "http://" + instance
@@ -60,7 +120,13 @@ func NewHTTPClient(instance string, tracer stdopentracing.Tracer, logger log.Log
 		return nil, err
 	}
 
-	limiter := ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), 100))
+	options := clientOptions{qps: 1, burst: 100, breaker: gobreaker.Settings{Timeout: 30 * time.Second}}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	limiter := options.limiter()
+	adaptiveLimiter := adaptive.NewLimiter("http-client")
+	otelClient := HTTPClientOption(tp)
 
 	var pingEndpoint endpoint.Endpoint
 	{
@@ -69,21 +135,122 @@ func NewHTTPClient(instance string, tracer stdopentracing.Tracer, logger log.Log
 			copyURL(u, "/ping"),
 			encodeHTTPGenericRequest,
 			decodeHTTPPingResponse,
+			httptransport.ClientBefore(httptransport.SetRequestHeader("Content-Type", "application/json; charset=utf-8")),
 			httptransport.ClientBefore(opentracing.ContextToHTTP(tracer, logger)),
+			httptransport.ClientBefore(otelHTTPClientBefore(propagator)),
+			otelClient,
 		).Endpoint()
 		pingEndpoint = opentracing.TraceClient(tracer, "Ping")(pingEndpoint)
 		pingEndpoint = limiter(pingEndpoint)
-		pingEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{
-			Name:    "Ping",
-			Timeout: 30 * time.Second,
-		}))(pingEndpoint)
+		pingEndpoint = adaptiveLimiter.Middleware()(pingEndpoint)
+		pingEndpoint = options.breakerFor("Ping")(pingEndpoint)
+	}
+
+	var listChallengesEndpoint endpoint.Endpoint
+	{
+		listChallengesEndpoint = httptransport.NewClient(
+			"GET",
+			copyURL(u, "/challenges"),
+			encodeHTTPGenericRequest,
+			decodeHTTPListChallengesResponse,
+			httptransport.ClientBefore(opentracing.ContextToHTTP(tracer, logger)),
+			httptransport.ClientBefore(otelHTTPClientBefore(propagator)),
+			otelClient,
+		).Endpoint()
+		listChallengesEndpoint = opentracing.TraceClient(tracer, "ListChallenges")(listChallengesEndpoint)
+		listChallengesEndpoint = limiter(listChallengesEndpoint)
+		listChallengesEndpoint = adaptiveLimiter.Middleware()(listChallengesEndpoint)
+		listChallengesEndpoint = options.breakerFor("ListChallenges")(listChallengesEndpoint)
+	}
+
+	var getChallengeEndpoint endpoint.Endpoint
+	{
+		getChallengeEndpoint = httptransport.NewClient(
+			"GET",
+			copyURL(u, "/challenges/"),
+			encodeHTTPGetChallengeRequest,
+			decodeHTTPGetChallengeResponse,
+			httptransport.ClientBefore(opentracing.ContextToHTTP(tracer, logger)),
+			httptransport.ClientBefore(otelHTTPClientBefore(propagator)),
+			otelClient,
+		).Endpoint()
+		getChallengeEndpoint = opentracing.TraceClient(tracer, "GetChallenge")(getChallengeEndpoint)
+		getChallengeEndpoint = limiter(getChallengeEndpoint)
+		getChallengeEndpoint = adaptiveLimiter.Middleware()(getChallengeEndpoint)
+		getChallengeEndpoint = options.breakerFor("GetChallenge")(getChallengeEndpoint)
+	}
+
+	var submitFlagEndpoint endpoint.Endpoint
+	{
+		submitFlagEndpoint = httptransport.NewClient(
+			"POST",
+			copyURL(u, "/submit"),
+			encodeHTTPGenericRequest,
+			decodeHTTPSubmitFlagResponse,
+			httptransport.ClientBefore(httptransport.SetRequestHeader("Content-Type", "application/json; charset=utf-8")),
+			httptransport.ClientBefore(opentracing.ContextToHTTP(tracer, logger)),
+			httptransport.ClientBefore(otelHTTPClientBefore(propagator)),
+			otelClient,
+		).Endpoint()
+		submitFlagEndpoint = opentracing.TraceClient(tracer, "SubmitFlag")(submitFlagEndpoint)
+		submitFlagEndpoint = limiter(submitFlagEndpoint)
+		submitFlagEndpoint = adaptiveLimiter.Middleware()(submitFlagEndpoint)
+		submitFlagEndpoint = options.breakerFor("SubmitFlag")(submitFlagEndpoint)
+	}
+
+	var getScoreboardEndpoint endpoint.Endpoint
+	{
+		getScoreboardEndpoint = httptransport.NewClient(
+			"GET",
+			copyURL(u, "/scoreboard"),
+			encodeHTTPGenericRequest,
+			decodeHTTPGetScoreboardResponse,
+			httptransport.ClientBefore(opentracing.ContextToHTTP(tracer, logger)),
+			httptransport.ClientBefore(otelHTTPClientBefore(propagator)),
+			otelClient,
+		).Endpoint()
+		getScoreboardEndpoint = opentracing.TraceClient(tracer, "GetScoreboard")(getScoreboardEndpoint)
+		getScoreboardEndpoint = limiter(getScoreboardEndpoint)
+		getScoreboardEndpoint = adaptiveLimiter.Middleware()(getScoreboardEndpoint)
+		getScoreboardEndpoint = options.breakerFor("GetScoreboard")(getScoreboardEndpoint)
 	}
 
 	return hackerendpoint.Set{
-		PingEndpoint: pingEndpoint,
+		PingEndpoint:           pingEndpoint,
+		ListChallengesEndpoint: listChallengesEndpoint,
+		GetChallengeEndpoint:   getChallengeEndpoint,
+		SubmitFlagEndpoint:     submitFlagEndpoint,
+		GetScoreboardEndpoint:  getScoreboardEndpoint,
 	}, nil
 }
 
+// HTTPMethodFactories returns the sd.Factory set for every
+// hackerendpoint method over HTTP, for use with NewDiscoverySet. Each
+// factory builds a full single-instance HTTP client via NewHTTPClient for
+// the discovered instance, and hands the load balancer back just the one
+// endpoint it's responsible for; NewHTTPClient's own rate limiting and
+// circuit breaking still apply underneath the discovery-level balancer
+// and retry. opts are forwarded to NewHTTPClient for every instance.
+func HTTPMethodFactories(tracer stdopentracing.Tracer, propagator otelpropagation.TextMapPropagator, tp oteltrace.TracerProvider, logger log.Logger, opts ...ClientOption) MethodFactories {
+	factory := func(method string) sd.Factory {
+		return func(instance string) (endpoint.Endpoint, io.Closer, error) {
+			svc, err := NewHTTPClient(instance, tracer, propagator, tp, logger, opts...)
+			if err != nil {
+				return nil, nil, err
+			}
+			ep, err := endpointByMethod(svc.(hackerendpoint.Set), method)
+			return ep, nil, err
+		}
+	}
+	return MethodFactories{
+		Ping:           factory("Ping"),
+		ListChallenges: factory("ListChallenges"),
+		GetChallenge:   factory("GetChallenge"),
+		SubmitFlag:     factory("SubmitFlag"),
+		GetScoreboard:  factory("GetScoreboard"),
+	}
+}
+
 func copyURL(base *url.URL, path string) *url.URL {
 	next := *base
 	next.Path = path
@@ -92,15 +259,12 @@ func copyURL(base *url.URL, path string) *url.URL {
 
 func errorEncoder(_ context.Context, err error, rw http.ResponseWriter) {
 	rw.WriteHeader(err2code(err))
-	json.NewEncoder(rw).Encode(errorWrapper{Error: err.Error()})
+	json.NewEncoder(rw).Encode(errorWrapper{Error: err.Error(), Code: hackerservice.ErrorCode(err)})
 }
 
 func err2code(err error) int {
-	switch err {
-	case hackerservice.ErrRandomFailure:
-		// ErrRandomFailure is a dummy error that is randomly returned from Ping().
-		// We return a "dummy" error when we get that.
-		return http.StatusTeapot
+	if c, ok := err.(interface{ HTTPStatus() int }); ok {
+		return c.HTTPStatus()
 	}
 	return http.StatusInternalServerError
 }
@@ -111,11 +275,19 @@ func errorDecoder(req *http.Response) error {
 		return err
 	}
 
+	if derr := hackerservice.CodeToError(w.Code); derr != nil {
+		return derr
+	}
 	return errors.New(w.Error)
 }
 
+// errorWrapper is the wire representation of an error returned over HTTP.
+// Code lets a client recover the original hackerservice error via
+// hackerservice.CodeToError, the HTTP counterpart to str2err/err2str in
+// grpc.go; Error carries the message for anything Code doesn't cover.
 type errorWrapper struct {
-	Error string `json:"error"`
+	Error string             `json:"error"`
+	Code  hackerservice.Code `json:"code"`
 }
 
 // decodeHTTPPingRequest is a transport/http.DecodeRequestFunc that decodes a
@@ -134,7 +306,7 @@ func decodeHTTPPingRequest(_ context.Context, r *http.Request) (interface{}, err
 // client.
 func decodeHTTPPingResponse(_ context.Context, r *http.Response) (interface{}, error) {
 	if r.StatusCode != http.StatusOK {
-		return nil, errors.New(r.Status)
+		return nil, errorDecoder(r)
 	}
 
 	var resp hackerendpoint.PingResponse
@@ -142,6 +314,101 @@ func decodeHTTPPingResponse(_ context.Context, r *http.Response) (interface{}, e
 	return resp, err
 }
 
+// decodeHTTPListChallengesRequest is a transport/http.DecodeRequestFunc that
+// returns an empty list-challenges request; the HTTP request body, if any,
+// is ignored. Primarily useful in a server.
+func decodeHTTPListChallengesRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return hackerendpoint.ListChallengesRequest{}, nil
+}
+
+// decodeHTTPListChallengesResponse is a transport/http.DecodeResponseFunc
+// that decodes a JSON-encoded list-challenges response from the HTTP
+// response body. Primarily useful in a client.
+func decodeHTTPListChallengesResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	if r.StatusCode != http.StatusOK {
+		return nil, errorDecoder(r)
+	}
+
+	var resp hackerendpoint.ListChallengesResponse
+	err := json.NewDecoder(r.Body).Decode(&resp)
+	return resp, err
+}
+
+// decodeHTTPGetChallengeRequest is a transport/http.DecodeRequestFunc that
+// extracts the challenge ID from the "/challenges/{id}" path. Primarily
+// useful in a server.
+func decodeHTTPGetChallengeRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id := strings.TrimPrefix(r.URL.Path, "/challenges/")
+	if id == "" {
+		return nil, errors.New("challenge id required")
+	}
+	return hackerendpoint.GetChallengeRequest{ID: id}, nil
+}
+
+// encodeHTTPGetChallengeRequest is a transport/http.EncodeRequestFunc that
+// encodes a get-challenge request into the "/challenges/{id}" path.
+// Primarily useful in a client.
+func encodeHTTPGetChallengeRequest(_ context.Context, r *http.Request, request interface{}) error {
+	req := request.(hackerendpoint.GetChallengeRequest)
+	r.URL.Path = "/challenges/" + req.ID
+	return nil
+}
+
+// decodeHTTPGetChallengeResponse is a transport/http.DecodeResponseFunc that
+// decodes a JSON-encoded get-challenge response from the HTTP response
+// body. Primarily useful in a client.
+func decodeHTTPGetChallengeResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	if r.StatusCode != http.StatusOK {
+		return nil, errorDecoder(r)
+	}
+
+	var resp hackerendpoint.GetChallengeResponse
+	err := json.NewDecoder(r.Body).Decode(&resp)
+	return resp, err
+}
+
+// decodeHTTPSubmitFlagRequest is a transport/http.DecodeRequestFunc that
+// decodes a JSON-encoded submit-flag request from the HTTP request body.
+// Primarily useful in a server.
+func decodeHTTPSubmitFlagRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req hackerendpoint.SubmitFlagRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	return req, err
+}
+
+// decodeHTTPSubmitFlagResponse is a transport/http.DecodeResponseFunc that
+// decodes a JSON-encoded submit-flag response from the HTTP response body.
+// Primarily useful in a client.
+func decodeHTTPSubmitFlagResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	if r.StatusCode != http.StatusOK {
+		return nil, errorDecoder(r)
+	}
+
+	var resp hackerendpoint.SubmitFlagResponse
+	err := json.NewDecoder(r.Body).Decode(&resp)
+	return resp, err
+}
+
+// decodeHTTPGetScoreboardRequest is a transport/http.DecodeRequestFunc that
+// returns an empty get-scoreboard request; the HTTP request body, if any,
+// is ignored. Primarily useful in a server.
+func decodeHTTPGetScoreboardRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return hackerendpoint.GetScoreboardRequest{}, nil
+}
+
+// decodeHTTPGetScoreboardResponse is a transport/http.DecodeResponseFunc
+// that decodes a JSON-encoded get-scoreboard response from the HTTP
+// response body. Primarily useful in a client.
+func decodeHTTPGetScoreboardResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	if r.StatusCode != http.StatusOK {
+		return nil, errorDecoder(r)
+	}
+
+	var resp hackerendpoint.GetScoreboardResponse
+	err := json.NewDecoder(r.Body).Decode(&resp)
+	return resp, err
+}
+
 // encodeHTTPGenericRequest is a transport/http.EncodeRequestFunc tht
 // JSON-encodes any request to the request body. Primarily useful in a client.
 func encodeHTTPGenericRequest(_ context.Context, r *http.Request, request interface{}) error {
@@ -0,0 +1,56 @@
+package hackertransport
+
+import (
+	"github.com/sony/gobreaker"
+	"golang.org/x/time/rate"
+
+	"github.com/go-kit/kit/circuitbreaker"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/ratelimit"
+)
+
+// ClientOption configures the rate limiting and circuit breaking that
+// NewHTTPClient, NewGRPCClient, and NewThriftClient bake into every
+// endpoint they return. The zero value of clientOptions is never used
+// directly; each constructor seeds its own transport-appropriate
+// defaults before applying opts.
+type ClientOption func(*clientOptions)
+
+type clientOptions struct {
+	qps     float64
+	burst   int
+	breaker gobreaker.Settings
+}
+
+// WithClientRateLimit caps the outgoing QPS a client applies across all
+// of its endpoints to qps, with bursts up to burst. It mirrors the
+// limiter addsvc's HTTP client guards its remote instance with.
+func WithClientRateLimit(qps float64, burst int) ClientOption {
+	return func(o *clientOptions) {
+		o.qps = qps
+		o.burst = burst
+	}
+}
+
+// WithCircuitBreaker overrides the gobreaker.Settings applied to each of
+// a client's endpoints. Settings.Name is overwritten per endpoint
+// regardless of what's passed here.
+func WithCircuitBreaker(settings gobreaker.Settings) ClientOption {
+	return func(o *clientOptions) {
+		o.breaker = settings
+	}
+}
+
+// limiter builds the shared rate-limiting middleware for o, to be
+// applied once across all of a client's endpoints.
+func (o clientOptions) limiter() endpoint.Middleware {
+	return ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Limit(o.qps), o.burst))
+}
+
+// breakerFor builds a circuit-breaker middleware for the endpoint named
+// name, using o.breaker as a template.
+func (o clientOptions) breakerFor(name string) endpoint.Middleware {
+	settings := o.breaker
+	settings.Name = name
+	return circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(settings))
+}
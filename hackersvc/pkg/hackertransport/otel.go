@@ -0,0 +1,64 @@
+package hackertransport
+
+import (
+	"context"
+	"net/http"
+
+	"google.golang.org/grpc"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+// otelHTTPServerBefore returns a transport/http.RequestFunc that extracts
+// an OpenTelemetry trace context propagated by the caller, if any, into
+// ctx using propagator. It's the server-side, OpenTelemetry counterpart
+// to opentracing.HTTPToContext, and is meant to run alongside
+// hackerendpoint.TracingMiddleware, which starts the actual span.
+func otelHTTPServerBefore(propagator propagation.TextMapPropagator) httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		return propagator.Extract(ctx, propagation.HeaderCarrier(r.Header))
+	}
+}
+
+// otelHTTPClientBefore returns a transport/http.RequestFunc that injects
+// the OpenTelemetry trace context found in ctx into the outgoing
+// request's headers using propagator. It's the client-side counterpart to
+// opentracing.ContextToHTTP.
+func otelHTTPClientBefore(propagator propagation.TextMapPropagator) httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		propagator.Inject(ctx, propagation.HeaderCarrier(r.Header))
+		return ctx
+	}
+}
+
+// GRPCServerOption returns the grpc.ServerOption that instruments a
+// *grpc.Server with OpenTelemetry, via otelgrpc's stats handler. Pass it
+// to grpc.NewServer alongside the pb.HackerServer built by NewGRPCServer.
+// Unlike HTTP, gRPC's own transport doesn't need a per-call ServerBefore:
+// otelgrpc instruments the whole connection.
+func GRPCServerOption(tp trace.TracerProvider) grpc.ServerOption {
+	return grpc.StatsHandler(otelgrpc.NewServerHandler(otelgrpc.WithTracerProvider(tp)))
+}
+
+// GRPCDialOption is the client-side counterpart to GRPCServerOption, for
+// use with grpc.Dial/grpc.NewClient when building the *grpc.ClientConn
+// passed to NewGRPCClient.
+func GRPCDialOption(tp trace.TracerProvider) grpc.DialOption {
+	return grpc.WithStatsHandler(otelgrpc.NewClientHandler(otelgrpc.WithTracerProvider(tp)))
+}
+
+// HTTPClientOption instruments an HTTP client's outgoing requests with
+// OpenTelemetry spans via otelhttp, for use with NewHTTPClient. This is
+// the HTTP counterpart to GRPCDialOption: unlike gRPC, go-kit's HTTP
+// transport has no single connection-level hook, so instrumentation is
+// installed on the *http.Client passed to each httptransport.NewClient.
+func HTTPClientOption(tp trace.TracerProvider) httptransport.ClientOption {
+	return httptransport.SetClient(&http.Client{
+		Transport: otelhttp.NewTransport(http.DefaultTransport, otelhttp.WithTracerProvider(tp)),
+	})
+}
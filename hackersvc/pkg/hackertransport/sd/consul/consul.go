@@ -0,0 +1,25 @@
+// Package consul wires up Consul-backed service discovery for hackersvc
+// clients, so they can depend on a logical service name instead of a single
+// host:port.
+package consul
+
+import (
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+	consulsd "github.com/go-kit/kit/sd/consul"
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+// NewInstancer returns an sd.Instancer that tracks the healthy instances of
+// service registered with the Consul agent at addr. Only instances passing
+// Consul's own health checks are returned; tags may be used to further
+// narrow the set, e.g. to a particular environment or version.
+func NewInstancer(addr, service string, tags []string, logger log.Logger) (sd.Instancer, error) {
+	apiClient, err := consulapi.NewClient(&consulapi.Config{Address: addr})
+	if err != nil {
+		return nil, err
+	}
+
+	client := consulsd.NewClient(apiClient)
+	return consulsd.NewInstancer(client, logger, service, tags, true), nil
+}
@@ -0,0 +1,19 @@
+// Package dnssrv wires up DNS SRV-backed service discovery for hackersvc
+// clients, for environments (e.g. Kubernetes headless services) that
+// publish instances via SRV records rather than a dedicated registry like
+// Consul.
+package dnssrv
+
+import (
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+	"github.com/go-kit/kit/sd/dnssrv"
+)
+
+// NewInstancer returns an sd.Instancer that re-resolves the SRV records for
+// name every ttl, and reports the resulting host:port instances.
+func NewInstancer(name string, ttl time.Duration, logger log.Logger) sd.Instancer {
+	return dnssrv.NewInstancer(name, ttl, dnssrv.Lookup, logger)
+}
@@ -0,0 +1,23 @@
+// Package etcdv3 wires up etcd-backed service discovery for hackersvc
+// clients, so they can depend on a key prefix that instances register
+// themselves under instead of a single host:port.
+package etcdv3
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+	etcd "github.com/go-kit/kit/sd/etcdv3"
+)
+
+// NewInstancer returns an sd.Instancer that tracks every instance
+// registered under prefix in the etcd cluster reachable via machines.
+func NewInstancer(ctx context.Context, machines []string, prefix string, logger log.Logger) (sd.Instancer, error) {
+	client, err := etcd.NewClient(ctx, machines, etcd.ClientOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return etcd.NewInstancer(client, prefix, logger)
+}
@@ -2,34 +2,47 @@ package hackertransport
 
 import (
 	"context"
+	"io"
 	"time"
 
-	"golang.org/x/time/rate"
-
+	"github.com/apache/thrift/lib/go/thrift"
+	stdopentracing "github.com/opentracing/opentracing-go"
 	"github.com/sony/gobreaker"
 
-	"github.com/go-kit/kit/circuitbreaker"
 	"github.com/go-kit/kit/endpoint"
-	"github.com/go-kit/kit/ratelimit"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
 
 	"github.com/ctfsys/backend/hackersvc/pkg/hackerendpoint"
 	"github.com/ctfsys/backend/hackersvc/pkg/hackerservice"
+	"github.com/ctfsys/backend/hackersvc/pkg/hackertransport/adaptive"
 	hackerthrift "github.com/ctfsys/backend/hackersvc/thrift/gen-go/hackersvc"
 )
 
 type thriftServer struct {
 	ctx       context.Context
 	endpoints hackerendpoint.Set
+	tracer    stdopentracing.Tracer
+	logger    log.Logger
 }
 
 // NewThriftServer makes a set of endpoints available as a Thrift service.
-func NewThriftServer(endpoints hackerendpoint.Set) hackerthrift.HackerService {
+// tracer extracts an OpenTracing SpanContext propagated by
+// TraceThriftClient from each call's THeader headers (see hackercli's
+// -thrift-protocol=header),
+// so Thrift calls participate in the same trace as HTTP and gRPC.
+func NewThriftServer(endpoints hackerendpoint.Set, tracer stdopentracing.Tracer, logger log.Logger) hackerthrift.HackerService {
 	return &thriftServer{
 		endpoints: endpoints,
+		tracer:    tracer,
+		logger:    logger,
 	}
 }
 
 func (s *thriftServer) Ping(ctx context.Context) (*hackerthrift.PingReply, error) {
+	ctx, span := TraceThriftServer(s.tracer, "Ping", s.logger, ctx)
+	defer span.Finish()
+
 	request := hackerendpoint.PingRequest{}
 	response, err := s.endpoints.PingEndpoint(ctx, request)
 	if err != nil {
@@ -37,20 +50,97 @@ func (s *thriftServer) Ping(ctx context.Context) (*hackerthrift.PingReply, error
 	}
 
 	resp := response.(hackerendpoint.PingResponse)
-	return &hackerthrift.PingReply{Value: resp.P, Err: err2str(resp.Err)}, nil
+	return &hackerthrift.PingReply{Value: resp.P, Err: err2str(resp.Err), ErrCode: errCode(resp.Err)}, nil
+}
+
+func (s *thriftServer) ListChallenges(ctx context.Context) (*hackerthrift.ListChallengesReply, error) {
+	ctx, span := TraceThriftServer(s.tracer, "ListChallenges", s.logger, ctx)
+	defer span.Finish()
+
+	request := hackerendpoint.ListChallengesRequest{}
+	response, err := s.endpoints.ListChallengesEndpoint(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := response.(hackerendpoint.ListChallengesResponse)
+	challenges := make([]*hackerthrift.Challenge, len(resp.Challenges))
+	for i, c := range resp.Challenges {
+		challenges[i] = challengeToThrift(c)
+	}
+	return &hackerthrift.ListChallengesReply{Challenges: challenges, Err: err2str(resp.Err), ErrCode: errCode(resp.Err)}, nil
+}
+
+func (s *thriftServer) GetChallenge(ctx context.Context, id string) (*hackerthrift.GetChallengeReply, error) {
+	ctx, span := TraceThriftServer(s.tracer, "GetChallenge", s.logger, ctx)
+	defer span.Finish()
+
+	request := hackerendpoint.GetChallengeRequest{ID: id}
+	response, err := s.endpoints.GetChallengeEndpoint(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := response.(hackerendpoint.GetChallengeResponse)
+	return &hackerthrift.GetChallengeReply{Challenge: challengeToThrift(resp.Challenge), Err: err2str(resp.Err), ErrCode: errCode(resp.Err)}, nil
+}
+
+func (s *thriftServer) SubmitFlag(ctx context.Context, challengeID, user, flag string) (*hackerthrift.SubmitFlagReply, error) {
+	ctx, span := TraceThriftServer(s.tracer, "SubmitFlag", s.logger, ctx)
+	defer span.Finish()
+
+	request := hackerendpoint.SubmitFlagRequest{ChallengeID: challengeID, User: user, Flag: flag}
+	response, err := s.endpoints.SubmitFlagEndpoint(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := response.(hackerendpoint.SubmitFlagResponse)
+	return &hackerthrift.SubmitFlagReply{Correct: resp.Correct, Err: err2str(resp.Err), ErrCode: errCode(resp.Err)}, nil
+}
+
+func (s *thriftServer) GetScoreboard(ctx context.Context) (*hackerthrift.GetScoreboardReply, error) {
+	ctx, span := TraceThriftServer(s.tracer, "GetScoreboard", s.logger, ctx)
+	defer span.Finish()
+
+	request := hackerendpoint.GetScoreboardRequest{}
+	response, err := s.endpoints.GetScoreboardEndpoint(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := response.(hackerendpoint.GetScoreboardResponse)
+	entries := make([]*hackerthrift.ScoreboardEntry, len(resp.Entries))
+	for i, e := range resp.Entries {
+		entries[i] = &hackerthrift.ScoreboardEntry{User: e.User, Points: int32(e.Points)}
+	}
+	return &hackerthrift.GetScoreboardReply{Entries: entries, Err: err2str(resp.Err), ErrCode: errCode(resp.Err)}, nil
 }
 
 // NewThriftClient returns a HackerService backed by a Thrift server described by
 // the provided client. The caller is responsible for constructing the client,
 // and eventually closing the underlying transport. We bake-in certain middlewares,
 // implementing the client library pattern.
-func NewThriftClient(client *hackerthrift.HackerServiceClient) hackerservice.Service {
+//
+// tracer is wired through TraceThriftClient, which requires a
+// THeaderProtocol client (see hackercli's -thrift-protocol=header) to actually carry the
+// SpanContext across the wire; with any other protocol the span is
+// created but never leaves the process.
+//
+// opts tune the client's rate limiting and circuit breaking; see
+// WithClientRateLimit and WithCircuitBreaker.
+func NewThriftClient(client *hackerthrift.HackerServiceClient, tracer stdopentracing.Tracer, logger log.Logger, opts ...ClientOption) hackerservice.Service {
 	// We construct a single ratelimiter middleware, to limit the total
 	// outgoing QPS from this client to all methods on the remote instance. We
 	// also construct per-endpoint circuitbreaker middlewares, although they
 	// could easily be combined into a single breaker for the entire remote
 	// instance, too.
-	limiter := ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), 100))
+	options := clientOptions{qps: 1, burst: 100, breaker: gobreaker.Settings{Timeout: 10 * time.Second}}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	limiter := options.limiter()
+	adaptiveLimiter := adaptive.NewLimiter("thrift-client")
 
 	// Each individual endpoint is an http/transport.Client (which implements
 	// endpoint.Endpoint) that gets wrapped with various middlewares. If you
@@ -59,18 +149,99 @@ func NewThriftClient(client *hackerthrift.HackerServiceClient) hackerservice.Ser
 	var pingEndpoint endpoint.Endpoint
 	{
 		pingEndpoint = MakeThriftPingEndpoint(client)
+		pingEndpoint = TraceThriftClient(tracer, "Ping", logger)(pingEndpoint)
 		pingEndpoint = limiter(pingEndpoint)
-		pingEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{
-			Name:    "Ping",
-			Timeout: 10 * time.Second,
-		}))(pingEndpoint)
+		pingEndpoint = adaptiveLimiter.Middleware()(pingEndpoint)
+		pingEndpoint = options.breakerFor("Ping")(pingEndpoint)
+	}
+
+	var listChallengesEndpoint endpoint.Endpoint
+	{
+		listChallengesEndpoint = MakeThriftListChallengesEndpoint(client)
+		listChallengesEndpoint = TraceThriftClient(tracer, "ListChallenges", logger)(listChallengesEndpoint)
+		listChallengesEndpoint = limiter(listChallengesEndpoint)
+		listChallengesEndpoint = adaptiveLimiter.Middleware()(listChallengesEndpoint)
+		listChallengesEndpoint = options.breakerFor("ListChallenges")(listChallengesEndpoint)
+	}
+
+	var getChallengeEndpoint endpoint.Endpoint
+	{
+		getChallengeEndpoint = MakeThriftGetChallengeEndpoint(client)
+		getChallengeEndpoint = TraceThriftClient(tracer, "GetChallenge", logger)(getChallengeEndpoint)
+		getChallengeEndpoint = limiter(getChallengeEndpoint)
+		getChallengeEndpoint = adaptiveLimiter.Middleware()(getChallengeEndpoint)
+		getChallengeEndpoint = options.breakerFor("GetChallenge")(getChallengeEndpoint)
+	}
+
+	var submitFlagEndpoint endpoint.Endpoint
+	{
+		submitFlagEndpoint = MakeThriftSubmitFlagEndpoint(client)
+		submitFlagEndpoint = TraceThriftClient(tracer, "SubmitFlag", logger)(submitFlagEndpoint)
+		submitFlagEndpoint = limiter(submitFlagEndpoint)
+		submitFlagEndpoint = adaptiveLimiter.Middleware()(submitFlagEndpoint)
+		submitFlagEndpoint = options.breakerFor("SubmitFlag")(submitFlagEndpoint)
+	}
+
+	var getScoreboardEndpoint endpoint.Endpoint
+	{
+		getScoreboardEndpoint = MakeThriftGetScoreboardEndpoint(client)
+		getScoreboardEndpoint = TraceThriftClient(tracer, "GetScoreboard", logger)(getScoreboardEndpoint)
+		getScoreboardEndpoint = limiter(getScoreboardEndpoint)
+		getScoreboardEndpoint = adaptiveLimiter.Middleware()(getScoreboardEndpoint)
+		getScoreboardEndpoint = options.breakerFor("GetScoreboard")(getScoreboardEndpoint)
 	}
 
 	// Returning the endpoint.Set as a service.Service relies on the
 	// endpoint.Set implementing the Service methods. That's just a simple bit
 	// of glue code.
 	return hackerendpoint.Set{
-		PingEndpoint: pingEndpoint,
+		PingEndpoint:           pingEndpoint,
+		ListChallengesEndpoint: listChallengesEndpoint,
+		GetChallengeEndpoint:   getChallengeEndpoint,
+		SubmitFlagEndpoint:     submitFlagEndpoint,
+		GetScoreboardEndpoint:  getScoreboardEndpoint,
+	}
+}
+
+// ThriftMethodFactories returns the sd.Factory set for every
+// hackerendpoint method over Thrift, for use with NewDiscoverySet. Each
+// factory opens a fresh socket and thrift.TTransport to the discovered
+// instance, builds a single-instance client via NewThriftClient, and
+// hands the load balancer back just the one endpoint it's responsible
+// for. The transport is returned as the io.Closer, so the balancer closes
+// it once that instance is dropped. tracer and opts are forwarded to
+// NewThriftClient for every instance.
+func ThriftMethodFactories(protocolFactory thrift.TProtocolFactory, transportFactory thrift.TTransportFactory, tracer stdopentracing.Tracer, logger log.Logger, opts ...ClientOption) MethodFactories {
+	factory := func(method string) sd.Factory {
+		return func(instance string) (endpoint.Endpoint, io.Closer, error) {
+			socket, err := thrift.NewTSocket(instance)
+			if err != nil {
+				return nil, nil, err
+			}
+			transport, err := transportFactory.GetTransport(socket)
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := transport.Open(); err != nil {
+				return nil, nil, err
+			}
+
+			client := hackerthrift.NewHackerServiceClientFactory(transport, protocolFactory)
+			svc := NewThriftClient(client, tracer, logger, opts...)
+			ep, err := endpointByMethod(svc.(hackerendpoint.Set), method)
+			if err != nil {
+				transport.Close()
+				return nil, nil, err
+			}
+			return ep, transport, nil
+		}
+	}
+	return MethodFactories{
+		Ping:           factory("Ping"),
+		ListChallenges: factory("ListChallenges"),
+		GetChallenge:   factory("GetChallenge"),
+		SubmitFlag:     factory("SubmitFlag"),
+		GetScoreboard:  factory("GetScoreboard"),
 	}
 }
 
@@ -83,9 +254,103 @@ func MakeThriftPingEndpoint(client *hackerthrift.HackerServiceClient) endpoint.E
 		// parameters to Ping
 		_ = request.(hackerendpoint.PingRequest)
 		reply, err := client.Ping(ctx)
-		if err == hackerservice.ErrRandomFailure {
-			return nil, err // special case; see comment on ErrRandomFailure
+		if err != nil {
+			return nil, err
+		}
+		return hackerendpoint.PingResponse{P: reply.Value, Err: str2err(reply.ErrCode, reply.Err)}, nil
+	}
+}
+
+// MakeThriftListChallengesEndpoint returns an endpoint that invokes the
+// passed Thrift client. Useful only in clients, and only until a proper
+// go-kit/kit/transport/thrift.Client exists.
+func MakeThriftListChallengesEndpoint(client *hackerthrift.HackerServiceClient) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		_ = request.(hackerendpoint.ListChallengesRequest)
+		reply, err := client.ListChallenges(ctx)
+		if err != nil {
+			return nil, err
+		}
+		challenges := make([]hackerservice.Challenge, len(reply.Challenges))
+		for i, c := range reply.Challenges {
+			challenges[i] = challengeFromThrift(c)
+		}
+		return hackerendpoint.ListChallengesResponse{Challenges: challenges, Err: str2err(reply.ErrCode, reply.Err)}, nil
+	}
+}
+
+// MakeThriftGetChallengeEndpoint returns an endpoint that invokes the passed
+// Thrift client. Useful only in clients, and only until a proper
+// go-kit/kit/transport/thrift.Client exists.
+func MakeThriftGetChallengeEndpoint(client *hackerthrift.HackerServiceClient) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(hackerendpoint.GetChallengeRequest)
+		reply, err := client.GetChallenge(ctx, req.ID)
+		if err != nil {
+			return nil, err
 		}
-		return hackerendpoint.PingResponse{P: reply.Value, Err: err}, nil
+		return hackerendpoint.GetChallengeResponse{
+			Challenge: challengeFromThrift(reply.Challenge),
+			Err:       str2err(reply.ErrCode, reply.Err),
+		}, nil
+	}
+}
+
+// MakeThriftSubmitFlagEndpoint returns an endpoint that invokes the passed
+// Thrift client. Useful only in clients, and only until a proper
+// go-kit/kit/transport/thrift.Client exists.
+func MakeThriftSubmitFlagEndpoint(client *hackerthrift.HackerServiceClient) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(hackerendpoint.SubmitFlagRequest)
+		reply, err := client.SubmitFlag(ctx, req.ChallengeID, req.User, req.Flag)
+		if err != nil {
+			return nil, err
+		}
+		return hackerendpoint.SubmitFlagResponse{Correct: reply.Correct, Err: str2err(reply.ErrCode, reply.Err)}, nil
+	}
+}
+
+// MakeThriftGetScoreboardEndpoint returns an endpoint that invokes the
+// passed Thrift client. Useful only in clients, and only until a proper
+// go-kit/kit/transport/thrift.Client exists.
+func MakeThriftGetScoreboardEndpoint(client *hackerthrift.HackerServiceClient) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		_ = request.(hackerendpoint.GetScoreboardRequest)
+		reply, err := client.GetScoreboard(ctx)
+		if err != nil {
+			return nil, err
+		}
+		entries := make([]hackerservice.ScoreboardEntry, len(reply.Entries))
+		for i, e := range reply.Entries {
+			entries[i] = hackerservice.ScoreboardEntry{User: e.User, Points: int(e.Points)}
+		}
+		return hackerendpoint.GetScoreboardResponse{Entries: entries, Err: str2err(reply.ErrCode, reply.Err)}, nil
+	}
+}
+
+// challengeToThrift converts a user-domain Challenge to its Thrift wire
+// representation.
+func challengeToThrift(c hackerservice.Challenge) *hackerthrift.Challenge {
+	return &hackerthrift.Challenge{
+		Id:          c.ID,
+		Title:       c.Title,
+		Category:    c.Category,
+		Points:      int32(c.Points),
+		Description: c.Description,
+	}
+}
+
+// challengeFromThrift converts a Thrift Challenge back to the user-domain
+// type.
+func challengeFromThrift(c *hackerthrift.Challenge) hackerservice.Challenge {
+	if c == nil {
+		return hackerservice.Challenge{}
+	}
+	return hackerservice.Challenge{
+		ID:          c.Id,
+		Title:       c.Title,
+		Category:    c.Category,
+		Points:      int(c.Points),
+		Description: c.Description,
 	}
 }
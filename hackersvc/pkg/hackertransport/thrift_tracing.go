@@ -0,0 +1,82 @@
+package hackertransport
+
+import (
+	"context"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+)
+
+// thriftHeaderCarrier implements opentracing.TextMapWriter/TextMapReader
+// over a plain map, so a SpanContext can be injected/extracted with the
+// standard stdopentracing.TextMap format before being copied onto a
+// THeaderProtocol connection via thrift.SetHeader/thrift.GetHeaders, which
+// take and return a context.Context rather than satisfying
+// TextMapWriter/Reader themselves.
+type thriftHeaderCarrier map[string]string
+
+func (c thriftHeaderCarrier) Set(key, val string) {
+	c[key] = val
+}
+
+func (c thriftHeaderCarrier) ForeachKey(handler func(key, val string) error) error {
+	for k, v := range c {
+		if err := handler(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TraceThriftClient wraps a Thrift client endpoint with an OpenTracing
+// client span, injecting its SpanContext into the outgoing call's THeader
+// headers so a THeaderProtocol transport (see hackercli's
+// -thrift-protocol=header) carries it
+// across the wire to TraceThriftServer. It plays the combined role that
+// opentracing.TraceClient and ContextToHTTP play together for the HTTP
+// transport: MakeThrift*Endpoint calls have no ClientBefore-style hook to
+// split the two across, so this does both in one middleware.
+func TraceThriftClient(tracer stdopentracing.Tracer, operationName string, logger log.Logger) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			var parent stdopentracing.SpanContext
+			if parentSpan := stdopentracing.SpanFromContext(ctx); parentSpan != nil {
+				parent = parentSpan.Context()
+			}
+			span := tracer.StartSpan(operationName, ext.SpanKindRPCClient, stdopentracing.ChildOf(parent))
+			defer span.Finish()
+
+			carrier := thriftHeaderCarrier{}
+			if err := tracer.Inject(span.Context(), stdopentracing.TextMap, carrier); err != nil {
+				logger.Log("err", err)
+			}
+			for k, v := range carrier {
+				ctx = thrift.SetHeader(ctx, k, v)
+			}
+			ctx = stdopentracing.ContextWithSpan(ctx, span)
+
+			return next(ctx, request)
+		}
+	}
+}
+
+// TraceThriftServer extracts an OpenTracing SpanContext propagated via
+// THeader headers (by TraceThriftClient) from ctx, starts the server span
+// as its child, and returns both the span and a ctx carrying it. It's the
+// Thrift counterpart to opentracing.HTTPToContext/GRPCToContext, called
+// directly by thriftServer's methods since the generated
+// hackerthrift.HackerService interface offers no ServerBefore-style hook
+// to wire it in generically. Callers must defer span.Finish().
+func TraceThriftServer(tracer stdopentracing.Tracer, operationName string, logger log.Logger, ctx context.Context) (context.Context, stdopentracing.Span) {
+	carrier := thriftHeaderCarrier(thrift.GetHeaders(ctx))
+	wireContext, err := tracer.Extract(stdopentracing.TextMap, carrier)
+	if err != nil && err != stdopentracing.ErrSpanContextNotFound {
+		logger.Log("err", err)
+	}
+	span := tracer.StartSpan(operationName, ext.RPCServerOption(wireContext))
+	return stdopentracing.ContextWithSpan(ctx, span), span
+}